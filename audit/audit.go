@@ -0,0 +1,167 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package audit implements secrets lifecycle events log.
+// Events never contain content, and item's keys are replaced by their keyed hashes.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lifecycle actions.
+const (
+	ActionCreate         = "create"
+	ActionRead           = "read"
+	ActionFailedPassword = "failed_password"
+	ActionBurn           = "burn"
+	ActionRevoke         = "revoke"
+	ActionExpire         = "expire"
+	ActionDelete         = "delete"
+)
+
+// Sink types.
+const (
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+)
+
+// Event is a lifecycle event of an item.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Item    string    `json:"item"`
+	Creator string    `json:"creator,omitempty"`
+	IP      string    `json:"ip,omitempty"`
+	Times   int       `json:"times,omitempty"`
+}
+
+// Sink is events storage.
+type Sink interface {
+	Send(e *Event) error
+	Close() error
+}
+
+// jsonSink writes events as JSON lines.
+type jsonSink struct {
+	sync.Mutex
+	w io.WriteCloser
+}
+
+// Send writes the event as one JSON line.
+func (s *jsonSink) Send(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the sink writer.
+func (s *jsonSink) Close() error {
+	return s.w.Close()
+}
+
+// nopCloser is a writer that can't be closed, like standard output.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Cfg is audit settings. Path is a file name for "file" sink,
+// Tag is a syslog tag for "syslog" one. Empty sink disables audit log.
+type Cfg struct {
+	Sink string `json:"sink"`
+	Path string `json:"path"`
+	Tag  string `json:"tag"`
+	key  []byte
+	sink Sink
+}
+
+// Init opens configured sink, key is used to hash item's keys.
+func (c *Cfg) Init(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("empty audit key")
+	}
+	c.key = key
+	switch c.Sink {
+	case "":
+		return nil
+	case SinkStdout:
+		c.sink = &jsonSink{w: nopCloser{os.Stdout}}
+	case SinkFile:
+		if c.Path == "" {
+			return errors.New("audit file path is required")
+		}
+		// append-only, existing records are never changed
+		f, err := os.OpenFile(c.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		c.sink = &jsonSink{w: f}
+	case SinkSyslog:
+		s, err := newSyslog(c.Tag)
+		if err != nil {
+			return err
+		}
+		c.sink = s
+	default:
+		return fmt.Errorf("unknown audit sink %v", c.Sink)
+	}
+	return nil
+}
+
+// SetSink replaces the sink by custom one.
+func (c *Cfg) SetSink(s Sink) {
+	c.sink = s
+}
+
+// Enabled returns true if events are logged.
+func (c *Cfg) Enabled() bool {
+	return (c != nil) && (c.sink != nil)
+}
+
+// Hash returns keyed hash of item's key, so events can be matched without the keys disclosure.
+func (c *Cfg) Hash(key string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Log sends the event about item with a key, event's time is set to now if it's empty.
+func (c *Cfg) Log(key string, e *Event, now time.Time) error {
+	if !c.Enabled() {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = now.UTC()
+	}
+	e.Item = c.Hash(key)
+	return c.sink.Send(e)
+}
+
+// Close closes the sink.
+func (c *Cfg) Close() error {
+	if !c.Enabled() {
+		return nil
+	}
+	return c.sink.Close()
+}
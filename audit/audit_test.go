@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCfg_Init(t *testing.T) {
+	cases := []struct {
+		c   *Cfg
+		err bool
+	}{
+		{c: &Cfg{}},
+		{c: &Cfg{Sink: SinkStdout}},
+		{c: &Cfg{Sink: SinkFile}, err: true},
+		{c: &Cfg{Sink: SinkFile, Path: "/absent/audit.log"}, err: true},
+		{c: &Cfg{Sink: "kafka"}, err: true},
+	}
+	for i, c := range cases {
+		err := c.c.Init(testKey)
+		if (err != nil) != c.err {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+	}
+	if err := (&Cfg{}).Init(nil); err == nil {
+		t.Error("expected error for empty key")
+	}
+	var disabled *Cfg
+	if disabled.Enabled() {
+		t.Error("nil settings should be disabled")
+	}
+	if err := disabled.Log("abc", &Event{Action: ActionCreate}, time.Now()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCfg_Log(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enigma-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed remove %v: %v", dir, err)
+		}
+	}()
+	name := filepath.Join(dir, "audit.log")
+	actions := []string{ActionCreate, ActionRead, ActionBurn}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("UTC+3", 3*3600))
+	// the file is opened twice, the second time records are appended
+	for i := 0; i < 2; i++ {
+		c := &Cfg{Sink: SinkFile, Path: name}
+		err = c.Init(testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, action := range actions {
+			err = c.Log("secret-key", &Event{Action: action, IP: "127.0.0.1", Creator: "token:ci"}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []*Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "secret-key") {
+			t.Errorf("item key is not hashed: %v", scanner.Text())
+		}
+		e := &Event{}
+		err = json.Unmarshal(scanner.Bytes(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if n := len(events); n != len(actions)*2 {
+		t.Fatalf("failed events number %v", n)
+	}
+	hash := (&Cfg{key: testKey}).Hash("secret-key")
+	for i, e := range events {
+		if (e.Action != actions[i%len(actions)]) || (e.Item != hash) || !e.Time.Equal(now) || (e.IP != "127.0.0.1") {
+			t.Errorf("failed event %v: %v", i, e)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+// defaultTag is default syslog tag.
+const defaultTag = "enigma"
+
+// newSyslog returns a sink that sends JSON events to local syslog.
+func newSyslog(tag string) (Sink, error) {
+	if tag == "" {
+		tag = defaultTag
+	}
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonSink{w: w}, nil
+}
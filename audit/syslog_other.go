@@ -0,0 +1,16 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+//go:build windows || plan9
+
+package audit
+
+import (
+	"errors"
+)
+
+// newSyslog returns an error, because syslog is not available.
+func newSyslog(tag string) (Sink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package auth implements optional creators authentication:
+// OIDC login for web UI and static bearer tokens for API clients.
+// Readers are always anonymous.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionName is a name of creator's session cookie.
+	SessionName = "session"
+	// TokenPrefix is a prefix of creator identity for API tokens.
+	TokenPrefix = "token:"
+	// OIDCPrefix is a prefix of creator identity for OIDC users.
+	OIDCPrefix = "oidc:"
+
+	// defaultSessionTTL is session lifetime in seconds.
+	defaultSessionTTL = 43200
+	// bearerPrefix is a prefix of Authorization header value.
+	bearerPrefix = "Bearer "
+)
+
+// Cfg is authentication settings. Tokens are names of API clients
+// with SHA-256 hex hashes of their bearer tokens.
+type Cfg struct {
+	OIDC       *OIDCCfg          `json:"oidc"`
+	Tokens     map[string]string `json:"tokens"`
+	SessionTTL int64             `json:"session_ttl"`
+	key        []byte
+	secure     bool
+	path       string
+	sessionTTL time.Duration
+	provider   *provider
+}
+
+// Init checks the settings, key is used to sign sessions cookies,
+// secure sets HTTPS only cookies and path is their URL path, the service base path.
+// OIDC provider is discovered using its issuer URL.
+func (c *Cfg) Init(ctx context.Context, key []byte, secure bool, path string) error {
+	if len(key) == 0 {
+		return errors.New("empty auth key")
+	}
+	if c.SessionTTL == 0 {
+		c.SessionTTL = defaultSessionTTL
+	}
+	if c.SessionTTL < 1 {
+		return errors.New("session_ttl should be positive")
+	}
+	for name, hash := range c.Tokens {
+		b, err := hex.DecodeString(hash)
+		if (err != nil) || (len(b) != sha256.Size) || (name == "") {
+			return fmt.Errorf("token %q should be SHA-256 hex hash", name)
+		}
+	}
+	c.key, c.secure, c.path = key, secure, path
+	c.sessionTTL = time.Duration(c.SessionTTL) * time.Second
+	if c.OIDC == nil {
+		return nil
+	}
+	p, err := c.OIDC.discover(ctx)
+	if err != nil {
+		return err
+	}
+	c.provider = p
+	return nil
+}
+
+// Enabled returns true if creators should be authenticated.
+func (c *Cfg) Enabled() bool {
+	return (c != nil) && ((c.OIDC != nil) || (len(c.Tokens) > 0))
+}
+
+// Login returns true if web UI login is available.
+func (c *Cfg) Login() bool {
+	return (c != nil) && (c.provider != nil)
+}
+
+// HashToken returns a hash of API token for configuration file.
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// Creator returns authenticated creator identity, it's empty for anonymous requests,
+// now is current time to check session expiration.
+// Bearer is true if a valid API token was used, such requests don't need CSRF tokens.
+func (c *Cfg) Creator(r *http.Request, now time.Time) (creator string, bearer bool) {
+	if !c.Enabled() {
+		return "", false
+	}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		hash := HashToken(strings.TrimPrefix(header, bearerPrefix))
+		for name, value := range c.Tokens {
+			if hmac.Equal([]byte(hash), []byte(value)) {
+				return TokenPrefix + name, true
+			}
+		}
+		return "", false
+	}
+	cookie, err := r.Cookie(SessionName)
+	if err != nil {
+		return "", false
+	}
+	return c.checkSession(cookie.Value, now), false
+}
+
+// sign returns HMAC-SHA256 signature of the value.
+func (c *Cfg) sign(value string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(SessionName + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// session returns signed session value "<identity>.<expiration>.<signature>".
+func (c *Cfg) session(identity string, expires time.Time) string {
+	value := base64.RawURLEncoding.EncodeToString([]byte(identity)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return value + "." + c.sign(value)
+}
+
+// checkSession returns creator identity from valid session value, or empty string.
+func (c *Cfg) checkSession(value string, now time.Time) string {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return ""
+	}
+	value, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(c.sign(value))) {
+		return ""
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return ""
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if (err != nil) || (now.Unix() > expires) {
+		return ""
+	}
+	identity, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ""
+	}
+	return string(identity)
+}
+
+// SetSession sets session cookie of the authenticated creator, now is current time.
+func (c *Cfg) SetSession(w http.ResponseWriter, identity string, now time.Time) {
+	expires := now.Add(c.sessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionName,
+		Value:    c.session(identity, expires),
+		Path:     c.path,
+		Expires:  expires,
+		Secure:   c.secure,
+		HttpOnly: true,
+		// OIDC callback is a cross-site redirect, strict cookie isn't sent after it
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSession removes session cookie.
+func (c *Cfg) ClearSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionName,
+		Value:    "",
+		Path:     c.path,
+		MaxAge:   -1,
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCfg_Init(t *testing.T) {
+	cases := []struct {
+		c   *Cfg
+		err bool
+	}{
+		{c: &Cfg{}},
+		{c: &Cfg{Tokens: map[string]string{"ci": HashToken("secret")}}},
+		{c: &Cfg{Tokens: map[string]string{"ci": "secret"}}, err: true},
+		{c: &Cfg{Tokens: map[string]string{"": HashToken("secret")}}, err: true},
+		{c: &Cfg{SessionTTL: -1}, err: true},
+		{c: &Cfg{OIDC: &OIDCCfg{Issuer: "http://127.0.0.1:1"}}, err: true},
+	}
+	for i, c := range cases {
+		err := c.c.Init(context.Background(), testKey, false, "/")
+		if (err != nil) != c.err {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+	}
+	if err := (&Cfg{}).Init(context.Background(), nil, false, "/"); err == nil {
+		t.Error("expected error for empty key")
+	}
+}
+
+func TestCfg_Creator(t *testing.T) {
+	var disabled *Cfg
+	if disabled.Enabled() || disabled.Login() {
+		t.Error("nil settings should be disabled")
+	}
+	c := &Cfg{Tokens: map[string]string{"ci": HashToken("secret")}}
+	err := c.Init(context.Background(), testKey, false, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header  string
+		cookie  string
+		creator string
+		bearer  bool
+	}{
+		{},
+		{header: "Bearer secret", creator: TokenPrefix + "ci", bearer: true},
+		{header: "Bearer other"},
+		{header: "Basic secret"},
+		{cookie: c.session(OIDCPrefix+"user@example.com", now.Add(time.Minute)), creator: OIDCPrefix + "user@example.com"},
+		{cookie: c.session(OIDCPrefix+"user@example.com", now.Add(-time.Minute))},
+		{cookie: strings.Replace(c.session("user", now.Add(time.Minute)), "dXNlcg", "YWRtaW4", 1)},
+		{cookie: "abc"},
+	}
+	for i, v := range cases {
+		r := httptest.NewRequest("POST", "/", nil)
+		if v.header != "" {
+			r.Header.Set("Authorization", v.header)
+		}
+		if v.cookie != "" {
+			r.Header.Set("Cookie", SessionName+"="+v.cookie)
+		}
+		creator, bearer := c.Creator(r, now)
+		if (creator != v.creator) || (bearer != v.bearer) {
+			t.Errorf("failed case=%v: %v, %v", i, creator, bearer)
+		}
+	}
+	w := httptest.NewRecorder()
+	c.SetSession(w, "oidc:user", now)
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		if !cookie.Expires.Equal(now.Add(defaultSessionTTL * time.Second)) {
+			t.Errorf("failed session expiration: %v", cookie.Expires)
+		}
+		r.AddCookie(cookie)
+	}
+	if creator, _ := c.Creator(r, now); creator != "oidc:user" {
+		t.Errorf("failed session creator: %v", creator)
+	}
+	if creator, _ := c.Creator(r, now.Add((defaultSessionTTL+1)*time.Second)); creator != "" {
+		t.Errorf("failed expired session creator: %v", creator)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// stateName is a name of OIDC login state cookie.
+	stateName = "oidc_state"
+	// stateLen is a number of random bytes of OIDC state and nonce.
+	stateLen = 16
+	// stateTTL is OIDC login lifetime in seconds.
+	stateTTL = 600
+	// defaultClaim is ID token claim with creator identity.
+	defaultClaim = "email"
+)
+
+// OIDCCfg is OpenID Connect provider settings.
+// Claim is ID token claim with creator identity, "email" by default.
+type OIDCCfg struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURL  string `json:"redirect_url"`
+	Claim        string `json:"claim"`
+}
+
+// provider is discovered OIDC provider.
+type provider struct {
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	claim    string
+}
+
+// discover checks the settings and gets provider's metadata.
+func (c *OIDCCfg) discover(ctx context.Context) (*provider, error) {
+	if (c.Issuer == "") || (c.ClientID == "") || (c.RedirectURL == "") {
+		return nil, errors.New("oidc issuer, client_id and redirect_url are required")
+	}
+	if c.Claim == "" {
+		c.Claim = defaultClaim
+	}
+	p, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &provider{
+		oauth: &oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: c.ClientID}),
+		claim:    c.Claim,
+	}, nil
+}
+
+// randomString returns random hex string.
+func randomString() (string, error) {
+	var b [stateLen]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// stateCookie returns OIDC login state cookie, negative maxAge removes it.
+func (c *Cfg) stateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     stateName,
+		Value:    value,
+		Path:     c.path,
+		MaxAge:   maxAge,
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// LoginURL returns provider's authorization URL. Its state and nonce are saved
+// in a short-lived cookie to check them after the callback.
+func (c *Cfg) LoginURL(w http.ResponseWriter) (string, error) {
+	if !c.Login() {
+		return "", errors.New("oidc is not configured")
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	value := state + "." + nonce
+	http.SetCookie(w, c.stateCookie(value+"."+c.sign(value), stateTTL))
+	return c.provider.oauth.AuthCodeURL(state, oidc.Nonce(nonce)), nil
+}
+
+// Callback handles provider's redirect: it checks the state, exchanges the code
+// and verifies ID token. It sets session cookie since now and returns creator identity.
+func (c *Cfg) Callback(w http.ResponseWriter, r *http.Request, now time.Time) (string, error) {
+	if !c.Login() {
+		return "", errors.New("oidc is not configured")
+	}
+	cookie, err := r.Cookie(stateName)
+	if err != nil {
+		return "", errors.New("oidc state cookie is not found")
+	}
+	http.SetCookie(w, c.stateCookie("", -1))
+	parts := strings.Split(cookie.Value, ".")
+	if (len(parts) != 3) || !hmac.Equal([]byte(parts[2]), []byte(c.sign(parts[0]+"."+parts[1]))) {
+		return "", errors.New("invalid oidc state cookie")
+	}
+	state, nonce := parts[0], parts[1]
+	query := r.URL.Query()
+	if query.Get("state") != state {
+		return "", errors.New("invalid oidc state")
+	}
+	if e := query.Get("error"); e != "" {
+		return "", fmt.Errorf("oidc error: %v", e)
+	}
+	token, err := c.provider.oauth.Exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		return "", err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("id_token is absent")
+	}
+	idToken, err := c.provider.verifier.Verify(r.Context(), raw)
+	if err != nil {
+		return "", err
+	}
+	if idToken.Nonce != nonce {
+		return "", errors.New("invalid oidc nonce")
+	}
+	claims := make(map[string]interface{})
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return "", err
+	}
+	identity, ok := claims[c.provider.claim].(string)
+	if !ok || (identity == "") {
+		return "", fmt.Errorf("id token claim %v is absent", c.provider.claim)
+	}
+	identity = OIDCPrefix + identity
+	c.SetSession(w, identity, now)
+	return identity, nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+// mockIssuer is a local OIDC provider, authorization code is a nonce for ID token.
+func mockIssuer(t *testing.T, clientID string) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("failed response: %v", err)
+		}
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/authorize",
+			"token_endpoint":                        s.URL + "/token",
+			"jwks_uri":                              s.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := json.Marshal(map[string]interface{}{
+			"iss":   s.URL,
+			"sub":   "123",
+			"aud":   clientID,
+			"email": "user@example.com",
+			"nonce": r.PostFormValue("code"),
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := token.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeJSON(w, map[string]interface{}{"access_token": "abc", "token_type": "Bearer", "id_token": raw})
+	})
+	return s
+}
+
+func TestCfg_Callback(t *testing.T) {
+	const clientID = "enigma"
+	issuer := mockIssuer(t, clientID)
+	c := &Cfg{OIDC: &OIDCCfg{
+		Issuer:       issuer.URL,
+		ClientID:     clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/login/callback",
+	}}
+	err := c.Init(context.Background(), testKey, true, "/enigma/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Login() || !c.Enabled() {
+		t.Fatal("login is not available")
+	}
+	// login redirects to the provider and saves state
+	w := httptest.NewRecorder()
+	loginURL, err := c.LoginURL(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, nonce := u.Query().Get("state"), u.Query().Get("nonce")
+	if (state == "") || (nonce == "") || (u.Query().Get("client_id") != clientID) {
+		t.Fatalf("failed login URL: %v", loginURL)
+	}
+	cookies := w.Result().Cookies()
+	// session clock is independent of ID token one
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	callback := func(state, code string) (string, *httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("GET", "/login/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		identity, err := c.Callback(w, r, now)
+		return identity, w, err
+	}
+	if _, _, err = callback("other", nonce); err == nil {
+		t.Error("expected error for invalid state")
+	}
+	if _, _, err = callback(state, "other nonce"); err == nil {
+		t.Error("expected error for invalid nonce")
+	}
+	identity, w, err := callback(state, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity != OIDCPrefix+"user@example.com" {
+		t.Errorf("failed identity: %v", identity)
+	}
+	r := httptest.NewRequest("POST", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		if (cookie.Path != "/enigma/") || !cookie.Secure || !cookie.HttpOnly || (cookie.SameSite != http.SameSiteLaxMode) {
+			t.Errorf("failed cookie attributes: %v", cookie)
+		}
+		if cookie.Name == stateName {
+			if cookie.MaxAge >= 0 {
+				t.Errorf("state cookie is not removed: %v", cookie)
+			}
+			continue
+		}
+		r.AddCookie(cookie)
+	}
+	if creator, _ := c.Creator(r, now); creator != identity {
+		t.Errorf("failed session creator: %v", creator)
+	}
+}
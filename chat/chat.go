@@ -0,0 +1,184 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package chat implements Slack and Mattermost slash commands:
+// requests verification, command text parsing and ephemeral replies.
+package chat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CreatorPrefix is a prefix of creator identity for chat users.
+	CreatorPrefix = "chat:"
+	// Ephemeral is a response type of replies visible only to the command's user.
+	Ephemeral = "ephemeral"
+
+	// defaultMaxAge is maximum age of signed request in seconds.
+	defaultMaxAge = 300
+	// signatureVersion is a version prefix of Slack signature.
+	signatureVersion = "v0"
+	// tokenPrefix is a prefix of Mattermost Authorization header value.
+	tokenPrefix = "Token "
+)
+
+// Cfg is slash commands settings. SigningSecret verifies Slack requests signatures,
+// Tokens are Mattermost commands tokens. MaxAge is maximum age of Slack requests in seconds.
+// Lang is a language of replies, it's negotiated for every request if it's empty.
+type Cfg struct {
+	SigningSecret string   `json:"signing_secret"`
+	Tokens        []string `json:"tokens"`
+	MaxAge        int64    `json:"max_age"`
+	Lang          string   `json:"lang"`
+	maxAge        time.Duration
+}
+
+// Command is parsed slash command. TTL and Times are empty if they are not set.
+type Command struct {
+	Content string
+	TTL     string
+	Times   string
+}
+
+// Reply is a response to slash command.
+type Reply struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// Init checks the settings.
+func (c *Cfg) Init() error {
+	if (c.SigningSecret == "") && (len(c.Tokens) == 0) {
+		return errors.New("chat needs signing_secret or tokens")
+	}
+	for _, token := range c.Tokens {
+		if token == "" {
+			return errors.New("empty chat token")
+		}
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = defaultMaxAge
+	}
+	if c.MaxAge < 1 {
+		return errors.New("chat max_age should be positive")
+	}
+	c.maxAge = time.Duration(c.MaxAge) * time.Second
+	return nil
+}
+
+// Enabled returns true if slash commands are configured.
+func (c *Cfg) Enabled() bool {
+	return c != nil
+}
+
+// sign returns Slack signature of the request body.
+func (c *Cfg) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(c.SigningSecret))
+	mac.Write([]byte(signatureVersion + ":" + timestamp + ":"))
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the request with raw body is sent by a chat server.
+// Slack requests are signed, and Mattermost ones contain a command token
+// in Authorization header or "token" form field.
+func (c *Cfg) Verify(header http.Header, body []byte, now time.Time) bool {
+	if signature := header.Get("X-Slack-Signature"); signature != "" {
+		if c.SigningSecret == "" {
+			return false
+		}
+		timestamp := header.Get("X-Slack-Request-Timestamp")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return false
+		}
+		// old requests can be replayed
+		if age := now.Sub(time.Unix(seconds, 0)); (age > c.maxAge) || (age < -c.maxAge) {
+			return false
+		}
+		return hmac.Equal([]byte(signature), []byte(c.sign(timestamp, body)))
+	}
+	token := strings.TrimPrefix(header.Get("Authorization"), tokenPrefix)
+	if token == "" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return false
+		}
+		token = values.Get("token")
+	}
+	if token == "" {
+		return false
+	}
+	for _, t := range c.Tokens {
+		if hmac.Equal([]byte(token), []byte(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Creator returns creator identity of the command's user from the request form.
+func Creator(values url.Values) string {
+	user := values.Get("user_id")
+	if user == "" {
+		return ""
+	}
+	return CreatorPrefix + values.Get("team_id") + "/" + user
+}
+
+// Parse returns a command from its text "[ttl=<ttl>] [times=<n>] <content>",
+// arguments are optional and can be in any order before the content.
+func Parse(text string) (*Command, error) {
+	cmd := &Command{}
+	text = strings.TrimSpace(text)
+	for text != "" {
+		arg := text
+		if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+			arg = text[:i]
+		}
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			break
+		}
+		switch name {
+		case "ttl":
+			cmd.TTL = value
+		case "times":
+			cmd.Times = value
+		default:
+			// not an argument, the content can contain "="
+			cmd.Content = text
+			return cmd, cmd.check()
+		}
+		if value == "" {
+			return nil, fmt.Errorf("empty argument %v", name)
+		}
+		text = strings.TrimSpace(text[len(arg):])
+	}
+	cmd.Content = text
+	return cmd, cmd.check()
+}
+
+// check returns an error if the command is incomplete.
+func (cmd *Command) check() error {
+	if cmd.Content == "" {
+		return errors.New("empty content")
+	}
+	return nil
+}
+
+// NewReply returns ephemeral reply with formatted text.
+func NewReply(format string, a ...interface{}) *Reply {
+	return &Reply{ResponseType: Ephemeral, Text: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Slack documentation example of signed slash command request.
+const (
+	slackSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	slackTimestamp = "1531420618"
+	slackSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	slackBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+)
+
+func TestCfg_Init(t *testing.T) {
+	cases := []struct {
+		c   *Cfg
+		err bool
+	}{
+		{c: &Cfg{SigningSecret: slackSecret}},
+		{c: &Cfg{Tokens: []string{"token"}}},
+		{c: &Cfg{}, err: true},
+		{c: &Cfg{Tokens: []string{""}}, err: true},
+		{c: &Cfg{SigningSecret: slackSecret, MaxAge: -1}, err: true},
+	}
+	for i, c := range cases {
+		err := c.c.Init()
+		if (err != nil) != c.err {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+	}
+	var disabled *Cfg
+	if disabled.Enabled() {
+		t.Error("nil settings should be disabled")
+	}
+}
+
+func TestCfg_Verify(t *testing.T) {
+	c := &Cfg{SigningSecret: slackSecret, Tokens: []string{"mm-token"}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	signed := time.Unix(1531420618, 0)
+	slack := func(timestamp, signature string) http.Header {
+		return http.Header{"X-Slack-Request-Timestamp": {timestamp}, "X-Slack-Signature": {signature}}
+	}
+	cases := []struct {
+		header http.Header
+		body   string
+		now    time.Time
+		ok     bool
+	}{
+		{slack(slackTimestamp, slackSignature), slackBody, signed.Add(time.Minute), true},
+		{slack(slackTimestamp, slackSignature), slackBody + "&x=1", signed, false},
+		{slack(slackTimestamp, slackSignature), slackBody, signed.Add(10 * time.Minute), false},
+		{slack(slackTimestamp, slackSignature), slackBody, signed.Add(-10 * time.Minute), false},
+		{slack("1531420619", slackSignature), slackBody, signed, false},
+		{slack("bad", slackSignature), slackBody, signed, false},
+		{slack(slackTimestamp, "v0=00"), slackBody, signed, false},
+		{http.Header{}, slackBody, signed, false},
+		{http.Header{}, "token=mm-token&text=abc", signed, true},
+		{http.Header{"Authorization": {"Token mm-token"}}, "text=abc", signed, true},
+		{http.Header{"Authorization": {"Token other"}}, "token=mm-token", signed, false},
+		{http.Header{}, "token=other", signed, false},
+		{http.Header{}, "token=%zz", signed, false},
+	}
+	for i, x := range cases {
+		if ok := c.Verify(x.header, []byte(x.body), x.now); ok != x.ok {
+			t.Errorf("failed case=%v", i)
+		}
+	}
+	// tokens only settings don't accept Slack signatures
+	c = &Cfg{Tokens: []string{"mm-token"}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Verify(slack(slackTimestamp, c.sign(slackTimestamp, []byte(slackBody))), []byte(slackBody), signed) {
+		t.Error("signature without signing secret is accepted")
+	}
+}
+
+func TestCreator(t *testing.T) {
+	values, err := url.ParseQuery(slackBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creator := Creator(values); creator != "chat:T1DC2JH3J/U2CERLKJA" {
+		t.Errorf("failed creator: %v", creator)
+	}
+	if creator := Creator(url.Values{"team_id": {"T1"}}); creator != "" {
+		t.Errorf("failed empty creator: %v", creator)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		text string
+		cmd  Command
+		err  bool
+	}{
+		{text: "secret", cmd: Command{Content: "secret"}},
+		{text: "  ttl=1h  my secret text ", cmd: Command{Content: "my secret text", TTL: "1h"}},
+		{text: "times=3 ttl=2d a\nb", cmd: Command{Content: "a\nb", TTL: "2d", Times: "3"}},
+		{text: "password=123", cmd: Command{Content: "password=123"}},
+		{text: "ttl=1h key=value", cmd: Command{Content: "key=value", TTL: "1h"}},
+		{text: "ttl=1h"},
+		{text: "ttl= secret", err: true},
+		{text: "", err: true},
+		{text: "times=1", err: true},
+	}
+	for i, c := range cases {
+		cmd, err := Parse(c.text)
+		if c.err || (c.cmd.Content == "") {
+			if err == nil {
+				t.Errorf("failed case=%v: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed case=%v: %v", i, err)
+			continue
+		}
+		if *cmd != c.cmd {
+			t.Errorf("failed case=%v: %+v", i, cmd)
+		}
+	}
+}
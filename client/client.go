@@ -0,0 +1,278 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package client is a Go client of Enigma JSON API.
+//
+//	c := client.New("https://enigma.example.com/")
+//	link, err := c.Create(ctx, client.Secret{Content: "text", TTL: time.Hour, Times: 1})
+//	content, status, err := c.Read(ctx, link.URL, "")
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRetries is a default number of request retries.
+	DefaultRetries = 3
+	// DefaultRetryDelay is a default delay before the first retry, it's doubled for next ones.
+	DefaultRetryDelay = 500 * time.Millisecond
+	// maxError is a maximum length of error response body.
+	maxError = 4 << 10
+	// maxRetryAfter is a maximum Retry-After delay to retry rate limited request,
+	// exceeded quota can be released only after hours.
+	maxRetryAfter = time.Minute
+)
+
+// Errors of API responses, they can be checked by errors.Is for returned *Error.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrTooLarge     = errors.New("too large")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// Error is an error response of API, RetryAfter is a delay from Retry-After header.
+type Error struct {
+	Code       int
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Error returns error text.
+func (e *Error) Error() string {
+	return fmt.Sprintf("enigma: status %d: %s", e.Code, e.Message)
+}
+
+// Is returns true if target is a sentinel error of the response status code.
+// Forbidden status for secret reading means failed password.
+func (e *Error) Is(target error) bool {
+	switch e.Code {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusMethodNotAllowed:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusRequestEntityTooLarge:
+		return target == ErrTooLarge
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return (e.Code >= http.StatusInternalServerError) && (target == ErrServer)
+}
+
+// Secret is a new secret. TTL is rounded down to seconds.
+type Secret struct {
+	Content   string
+	Password  string
+	Recipient string
+	TTL       time.Duration
+	Times     int
+}
+
+// Link is a created secret.
+type Link struct {
+	URL     string    `json:"url"`
+	Key     string    `json:"key"`
+	Times   int       `json:"times"`
+	Expires time.Time `json:"expires"`
+}
+
+// Status is a secret's state, expiration time is zero after the last reading.
+type Status struct {
+	Times   int       `json:"times"`
+	Expires time.Time `json:"expires"`
+}
+
+// Client is API client. Its fields should not be changed after the first request.
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// New returns new client of the service with base URL, for example "https://enigma.example.com/".
+func New(baseURL string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// Create saves new secret and returns its link.
+// It's never retried after network or gateway errors to prevent secrets duplication.
+func (c *Client) Create(ctx context.Context, secret Secret) (Link, error) {
+	var link Link
+	req := struct {
+		Content   string `json:"content"`
+		TTL       string `json:"ttl"`
+		Times     int    `json:"times"`
+		Password  string `json:"password,omitempty"`
+		Recipient string `json:"recipient,omitempty"`
+	}{
+		Content:   secret.Content,
+		TTL:       strconv.FormatInt(int64(secret.TTL/time.Second), 10),
+		Times:     secret.Times,
+		Password:  secret.Password,
+		Recipient: secret.Recipient,
+	}
+	err := c.do(ctx, "POST", "/api/secrets", req, &link)
+	return link, err
+}
+
+// Read returns the secret's content and its status after the reading.
+// The link is a secret URL or its key. A failed password returns ErrForbidden.
+// It's never retried after network or gateway errors, because a reading could be already spent.
+func (c *Client) Read(ctx context.Context, link, password string) (string, *Status, error) {
+	resp := struct {
+		Content string `json:"content"`
+		Status
+	}{}
+	req := struct {
+		Password string `json:"password"`
+	}{password}
+	err := c.do(ctx, "POST", secretPath(link)+"/read", req, &resp)
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.Content, &resp.Status, nil
+}
+
+// Status returns the secret's status without reading.
+func (c *Client) Status(ctx context.Context, link string) (*Status, error) {
+	status := &Status{}
+	err := c.do(ctx, "GET", secretPath(link), nil, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Revoke deletes the secret before its expiration.
+func (c *Client) Revoke(ctx context.Context, link string) error {
+	return c.do(ctx, "DELETE", secretPath(link), nil, nil)
+}
+
+// secretPath returns API path of the secret by its link or key.
+func secretPath(link string) string {
+	if u, err := url.Parse(link); err == nil {
+		link = u.Path
+	}
+	link = strings.TrimRight(link, "/")
+	return "/api/secrets/" + url.PathEscape(link[strings.LastIndex(link, "/")+1:])
+}
+
+// idempotent returns true if the request method can be repeated after network errors.
+func idempotent(method string) bool {
+	return (method == "GET") || (method == "DELETE")
+}
+
+// do sends API request with JSON body in and decodes JSON response to out.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := c.send(ctx, method, path, body, out)
+		if !retry || (attempt >= c.Retries) {
+			return err
+		}
+		if wait == 0 {
+			wait = delay
+			delay *= 2
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes one request attempt. It returns true if the request can be retried
+// and a delay from Retry-After response header.
+func (c *Client) send(ctx context.Context, method, path string, body []byte, out interface{}) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return idempotent(method) && (ctx.Err() == nil), 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{Code: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		data := struct {
+			Error string `json:"error"`
+		}{}
+		if json.NewDecoder(io.LimitReader(resp.Body, maxError)).Decode(&data) == nil && (data.Error != "") {
+			apiErr.Message = data.Error
+		}
+		delay, ok := retryAfter(resp.Header.Get("Retry-After"))
+		apiErr.RetryAfter = delay
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			// the request is rejected before any changes, so it is retried only if the server allows it soon
+			return ok && (delay <= maxRetryAfter), delay, apiErr
+		case http.StatusServiceUnavailable:
+			// a proxy can return it after the request is already handled
+			return idempotent(method), delay, apiErr
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return idempotent(method), 0, apiErr
+		}
+		return false, 0, apiErr
+	}
+	if (out == nil) || (resp.StatusCode == http.StatusNoContent) {
+		return false, 0, nil
+	}
+	return false, 0, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// retryAfter returns a delay from Retry-After header value in seconds and false if it's absent,
+// HTTP date format is not used by the service.
+func retryAfter(value string) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(value)
+	if (err != nil) || (seconds < 0) {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
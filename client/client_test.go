@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/web"
+)
+
+const testConfigName = "/tmp/config.example.json"
+
+func newServer(t *testing.T) *httptest.Server {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(web.NewServer(cfg, nil, nil, nil).Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		if err := cfg.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return ts
+}
+
+func TestClient(t *testing.T) {
+	ts := newServer(t)
+	c := New(ts.URL + "/")
+	ctx := context.Background()
+
+	link, err := c.Create(ctx, Secret{Content: "secret text", Password: "pwd", TTL: time.Hour, Times: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link.URL, ts.URL+"/") || !strings.HasSuffix(link.URL, link.Key) || (link.Times != 2) {
+		t.Fatalf("failed link: %+v", link)
+	}
+	if d := time.Until(link.Expires); (d <= 0) || (d > time.Hour) {
+		t.Errorf("failed expiration: %v", link.Expires)
+	}
+	status, err := c.Status(ctx, link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Times != 2 {
+		t.Errorf("failed status: %+v", status)
+	}
+	_, _, err = c.Read(ctx, link.URL, "bad")
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("failed password error: %v", err)
+	}
+	content, status, err := c.Read(ctx, link.Key, "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (content != "secret text") || (status.Times != 1) || status.Expires.IsZero() {
+		t.Errorf("failed reading: %q, %+v", content, status)
+	}
+	content, status, err = c.Read(ctx, link.URL, "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (content != "secret text") || (status.Times != 0) || !status.Expires.IsZero() {
+		t.Errorf("failed last reading: %q, %+v", content, status)
+	}
+	_, err = c.Status(ctx, link.URL)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed burned status: %v", err)
+	}
+}
+
+func TestClient_Revoke(t *testing.T) {
+	ts := newServer(t)
+	c := New(ts.URL)
+	ctx := context.Background()
+
+	link, err := c.Create(ctx, Secret{Content: "revoked", TTL: time.Hour, Times: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Revoke(ctx, link.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Revoke(ctx, link.URL); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed second revoke: %v", err)
+	}
+	if _, _, err = c.Read(ctx, link.URL, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed reading of revoked: %v", err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	ts := newServer(t)
+	c := New(ts.URL)
+	ctx := context.Background()
+
+	cases := []struct {
+		secret Secret
+		err    error
+	}{
+		{Secret{TTL: time.Hour, Times: 1}, ErrBadRequest},
+		{Secret{Content: "text", Times: 1}, ErrBadRequest},
+		{Secret{Content: "text", TTL: time.Hour}, ErrBadRequest},
+		{Secret{Content: strings.Repeat("x", 2<<20), TTL: time.Hour, Times: 1}, ErrTooLarge},
+	}
+	for i, x := range cases {
+		_, err := c.Create(ctx, x.secret)
+		if !errors.Is(err, x.err) {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || (apiErr.Message == "") {
+			t.Errorf("failed case=%v error type: %T", i, err)
+		}
+	}
+	if _, err := c.Status(ctx, strings.Repeat("ab", 64)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed unknown status: %v", err)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"times":1,"expires":"2024-03-01T12:00:00Z"}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL)
+	c.RetryDelay = time.Millisecond
+	status, err := c.Status(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (status.Times != 1) || (calls.Load() != 3) {
+		t.Errorf("failed status=%+v, calls=%v", status, calls.Load())
+	}
+	calls.Store(0)
+	c.Retries = 1
+	_, err = c.Status(context.Background(), "key")
+	if !errors.Is(err, ErrServer) || (calls.Load() != 2) {
+		t.Errorf("failed retries: %v, calls=%v", err, calls.Load())
+	}
+	// not idempotent request is not retried after unavailable service
+	calls.Store(0)
+	_, err = c.Create(context.Background(), Secret{Content: "text", TTL: time.Hour, Times: 1})
+	if !errors.Is(err, ErrServer) || (calls.Load() != 1) {
+		t.Errorf("failed create: %v, calls=%v", err, calls.Load())
+	}
+}
+
+func TestClient_RetryRateLimited(t *testing.T) {
+	var (
+		calls atomic.Int32
+		after atomic.Value
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if value := after.Load().(string); value != "" {
+			w.Header().Set("Retry-After", value)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL)
+	c.RetryDelay = time.Millisecond
+	cases := []struct {
+		after string
+		calls int32
+		delay time.Duration
+	}{
+		{after: "", calls: 1},
+		{after: "0", calls: DefaultRetries + 1},
+		{after: "3600", calls: 1, delay: time.Hour},
+	}
+	for i, v := range cases {
+		calls.Store(0)
+		after.Store(v.after)
+		_, err := c.Create(context.Background(), Secret{Content: "text", TTL: time.Hour, Times: 1})
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("failed case=%v: %v", i, err)
+		}
+		if (calls.Load() != v.calls) || (apiErr.RetryAfter != v.delay) {
+			t.Errorf("failed case=%v: calls=%v, retry after %v", i, calls.Load(), apiErr.RetryAfter)
+		}
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL)
+	c.RetryDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.Revoke(ctx, "key")
+	if !errors.Is(err, context.DeadlineExceeded) || (calls.Load() != 1) {
+		t.Errorf("failed canceled retry: %v, calls=%v", err, calls.Load())
+	}
+	// not idempotent request is not retried after bad gateway
+	calls.Store(0)
+	_, err = c.Create(context.Background(), Secret{Content: "text", TTL: time.Hour, Times: 1})
+	if !errors.Is(err, ErrServer) || (calls.Load() != 1) {
+		t.Errorf("failed create: %v, calls=%v", err, calls.Load())
+	}
+}
+
+func TestSecretPath(t *testing.T) {
+	cases := map[string]string{
+		"abc":                           "/api/secrets/abc",
+		"https://example.com/abc":       "/api/secrets/abc",
+		"https://example.com/base/abc/": "/api/secrets/abc",
+		"/base/abc?x=1":                 "/api/secrets/abc",
+	}
+	for link, expected := range cases {
+		if p := secretPath(link); p != expected {
+			t.Errorf("failed path for %v: %v", link, p)
+		}
+	}
+}
@@ -6,42 +6,104 @@
 package conf
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"io/ioutil"
+	"log"
 	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	textTemplate "text/template"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/audit"
+	"github.com/z0rr0/enigma/auth"
+	"github.com/z0rr0/enigma/chat"
 	"github.com/z0rr0/enigma/db"
+	"github.com/z0rr0/enigma/email"
+	"github.com/z0rr0/enigma/i18n"
 	"github.com/z0rr0/enigma/page"
 )
 
-// settings is app settings.
+const (
+	// defaultCodeLimit is a number of passphrase code lookups from one IP address during CodeWindow.
+	defaultCodeLimit = 5
+	// defaultCodeGlobalLimit is a number of all passphrase code lookups during CodeWindow without delays.
+	defaultCodeGlobalLimit = 100
+	// CodeWindow is a period of passphrase code lookups rate limits in seconds.
+	CodeWindow = 600
+	// defaultMaxBody is a maximum size of request body in bytes.
+	defaultMaxBody = 1 << 20
+	// defaultMaxContent is a maximum size of item's content in bytes.
+	defaultMaxContent = 64 << 10
+	// defaultShutdownTimeout is a period in seconds to finish active requests on shutdown.
+	defaultShutdownTimeout = 30
+	// defaultFormTTL is a default TTL of forms in seconds, it's limited by TTL settings.
+	defaultFormTTL = 86400
+)
+
+// defaultHeaders are security HTTP headers for all responses.
+var defaultHeaders = map[string]string{
+	"Content-Security-Policy": "default-src 'none'; script-src 'self'; style-src 'self'; img-src 'self'; " +
+		"form-action 'self'; frame-ancestors 'none'; base-uri 'none'",
+	"X-Frame-Options":        "DENY",
+	"X-Content-Type-Options": "nosniff",
+	"Referrer-Policy":        "no-referrer",
+	"Cache-Control":          "no-store",
+}
+
+// settings is app settings, FormTTL is a default TTL of forms in a range [MinTTL; TTL].
 type settings struct {
-	TTL   int `json:"ttl"`
-	Times int `json:"times"`
+	MinTTL   int  `json:"min_ttl"`
+	TTL      int  `json:"ttl"`
+	FormTTL  int  `json:"-"`
+	Times    int  `json:"times"`
+	SkipBots bool `json:"skip_bots"`
+	db.KeyFormat
+	Codes           bool  `json:"codes"`
+	CodeLimit       int   `json:"code_limit"`
+	CodeGlobalLimit int   `json:"code_global_limit"`
+	MaxBody         int64 `json:"max_body"`
+	MaxContent      int   `json:"max_content"`
+	db.Quota
 }
 
 // Cfg is configuration settings.
 type Cfg struct {
-	Host      string   `json:"host"`
-	Port      uint     `json:"port"`
-	Timeout   int64    `json:"timeout"`
-	Secure    bool     `json:"secure"`
-	Redis     *db.Cfg  `json:"redis"`
-	Key       string   `json:"key"`
-	Settings  settings `json:"settings"`
-	CipherKey []byte
-	Templates map[string]*template.Template
-	timeout   time.Duration
-	pool      *redis.Pool
+	Host            string            `json:"host"`
+	Port            uint              `json:"port"`
+	Timeout         int64             `json:"timeout"`
+	ShutdownTimeout int64             `json:"shutdown_timeout"`
+	ShutdownDelay   int64             `json:"shutdown_delay"`
+	Secure          bool              `json:"secure"`
+	Redis           *db.Cfg           `json:"redis"`
+	Auth            *auth.Cfg         `json:"auth"`
+	Audit           *audit.Cfg        `json:"audit"`
+	Chat            *chat.Cfg         `json:"chat"`
+	Mail            *email.Cfg        `json:"mail"`
+	Key             string            `json:"key"`
+	Settings        settings          `json:"settings"`
+	Headers         map[string]string `json:"headers"`
+	Theme           string            `json:"theme"`
+	BasePath        string            `json:"base_path"`
+	CipherKey       []byte
+	Templates       map[string]*template.Template
+	MailTemplates   map[string]*textTemplate.Template
+	Static          fs.FS
+	Catalog         i18n.Catalog
+	timeout         time.Duration
+	pool            db.Pool
+	logger          *log.Logger
+	clock           func() time.Time
 }
 
 // isValid checks the settings are valid.
@@ -52,15 +114,64 @@ func (c *Cfg) isValid() error {
 	if c.Port < 1 {
 		return errors.New("port should be positive")
 	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if (c.ShutdownTimeout < 1) || (c.ShutdownDelay < 0) {
+		return errors.New("shutdown_timeout should be positive and shutdown_delay should not be negative")
+	}
 	if c.Settings.TTL < 1 {
 		return errors.New("ttl setting should be positive")
 	}
+	if c.Settings.MinTTL == 0 {
+		c.Settings.MinTTL = 1
+	}
+	if (c.Settings.MinTTL < 1) || (c.Settings.MinTTL > c.Settings.TTL) {
+		return errors.New("min_ttl setting should be in a range [1; ttl]")
+	}
+	c.Settings.FormTTL = defaultFormTTL
+	if c.Settings.FormTTL > c.Settings.TTL {
+		c.Settings.FormTTL = c.Settings.TTL
+	}
+	if c.Settings.FormTTL < c.Settings.MinTTL {
+		c.Settings.FormTTL = c.Settings.MinTTL
+	}
 	if c.Settings.Times < 1 {
 		return errors.New("times setting should be positive")
 	}
+	if c.Settings.CodeLimit == 0 {
+		c.Settings.CodeLimit = defaultCodeLimit
+	}
+	if c.Settings.CodeGlobalLimit == 0 {
+		c.Settings.CodeGlobalLimit = defaultCodeGlobalLimit
+	}
+	if (c.Settings.CodeLimit < 1) || (c.Settings.CodeGlobalLimit < c.Settings.CodeLimit) {
+		return errors.New("code_limit setting should be positive and not greater than code_global_limit")
+	}
+	if c.Settings.MaxBody == 0 {
+		c.Settings.MaxBody = defaultMaxBody
+	}
+	if c.Settings.MaxContent == 0 {
+		c.Settings.MaxContent = defaultMaxContent
+	}
+	if (c.Settings.MaxContent < 1) || (int64(c.Settings.MaxContent) > c.Settings.MaxBody) {
+		return errors.New("max_content setting should be positive and not greater than max_body")
+	}
+	if (c.Settings.Quota.Count < 0) || (c.Settings.Quota.Bytes < 0) {
+		return errors.New("quota_count and quota_bytes settings should not be negative")
+	}
+	err := c.Settings.KeyFormat.Validate()
+	if err != nil {
+		return err
+	}
 	c.timeout = time.Duration(c.Timeout) * time.Second
+	c.setHeaders()
+	err = c.setBasePath()
+	if err != nil {
+		return err
+	}
 
-	err := c.loadTemplates()
+	err = c.loadTemplates()
 	if err != nil {
 		return err
 	}
@@ -69,16 +180,54 @@ func (c *Cfg) isValid() error {
 		return errors.New("can not decode secret key")
 	}
 	c.CipherKey = b
-	pool, err := db.GetDbPool(c.Redis)
-	if err != nil {
-		return err
+	if c.Auth != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err = c.Auth.Init(ctx, c.CipherKey, c.Secure, c.BasePath)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	if c.Audit != nil {
+		err = c.Audit.Init(c.CipherKey)
+		if err != nil {
+			return err
+		}
+	}
+	if c.Chat != nil {
+		err = c.Chat.Init()
+		if err != nil {
+			return err
+		}
+		if _, ok := c.Catalog[c.Chat.Lang]; (c.Chat.Lang != "") && !ok {
+			return fmt.Errorf("unknown chat language %v", c.Chat.Lang)
+		}
+	}
+	if c.Mail != nil {
+		err = c.Mail.Init()
+		if err != nil {
+			return err
+		}
 	}
-	c.pool = pool
 	return nil
 }
 
 // New returns new configuration.
 func New(filename string) (*Cfg, error) {
+	c, err := Read(filename)
+	if err != nil {
+		return nil, err
+	}
+	c.pool, err = db.GetDbPool(c.Redis)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read returns valid configuration from the file without database connections,
+// so a connections pool should be set by With method before usage.
+func Read(filename string) (*Cfg, error) {
 	fullPath, err := filepath.Abs(strings.Trim(filename, " "))
 	if err != nil {
 		return nil, err
@@ -105,7 +254,20 @@ func New(filename string) (*Cfg, error) {
 
 // Close frees resources.
 func (c *Cfg) Close() error {
-	return c.closeRedisPool()
+	return c.close(true)
+}
+
+// close frees resources, the database pool is kept if it's used by other configuration.
+func (c *Cfg) close(pool bool) error {
+	errAudit := c.Audit.Close()
+	if !pool {
+		return errAudit
+	}
+	err := c.closeRedisPool()
+	if err != nil {
+		return err
+	}
+	return errAudit
 }
 
 // Addr returns service's net address.
@@ -126,30 +288,126 @@ func (c *Cfg) HandleTimeout() time.Duration {
 	return c.timeout
 }
 
-// loadTemplates loads HTML templates to memory.
+// Shutdown returns a delay between readiness check failure and the server shutdown,
+// and a deadline to finish active requests.
+func (c *Cfg) Shutdown() (time.Duration, time.Duration) {
+	return time.Duration(c.ShutdownDelay) * time.Second, time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// setHeaders merges custom security headers with default ones,
+// a header with empty value is disabled.
+func (c *Cfg) setHeaders() {
+	headers := make(map[string]string, len(defaultHeaders)+len(c.Headers))
+	for name, value := range defaultHeaders {
+		headers[name] = value
+	}
+	for name, value := range c.Headers {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if value == "" {
+			delete(headers, name)
+		} else {
+			headers[name] = value
+		}
+	}
+	c.Headers = headers
+}
+
+// setBasePath normalizes URL path prefix of the service, it starts and ends with a slash.
+func (c *Cfg) setBasePath() error {
+	base := strings.TrimSpace(c.BasePath)
+	if strings.ContainsAny(base, "?#%") {
+		return errors.New("base_path should be a plain URL path")
+	}
+	base = path.Clean("/" + base)
+	if base != "/" {
+		base += "/"
+	}
+	c.BasePath = base
+	return nil
+}
+
+// loadTemplates loads HTML and email templates, static files and translations of the theme to memory.
 func (c *Cfg) loadTemplates() error {
 	if len(c.Templates) > 0 {
 		return errors.New("templates are already loaded")
 	}
-	pages := map[string]string{
-		"index":   page.Index,
-		"error":   page.Error,
-		"result":  page.Result,
-		"read":    page.Read,
-		"content": page.Content,
+	theme, err := page.Theme(c.Theme)
+	if err != nil {
+		return err
 	}
-	c.Templates = make(map[string]*template.Template, len(pages))
-
-	for name, content := range pages {
-		tpl, err := template.New(name).Parse(content)
+	templates := make(map[string]*template.Template, len(page.Names))
+	for _, name := range page.Names {
+		content, err := fs.ReadFile(theme, path.Join(page.TemplatesDir, name+".html"))
+		if err != nil {
+			return err
+		}
+		tpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return err
+		}
+		templates[name] = tpl
+	}
+	mailTemplates := make(map[string]*textTemplate.Template, len(page.MailNames))
+	for _, name := range page.MailNames {
+		content, err := fs.ReadFile(theme, path.Join(page.MailDir, name+".txt"))
 		if err != nil {
 			return err
 		}
-		c.Templates[name] = tpl
+		tpl, err := textTemplate.New(name).Parse(string(content))
+		if err != nil {
+			return err
+		}
+		mailTemplates[name] = tpl
 	}
+	static, err := fs.Sub(theme, page.StaticDir)
+	if err != nil {
+		return err
+	}
+	translations, err := fs.Sub(theme, page.I18nDir)
+	if err != nil {
+		return err
+	}
+	catalog, err := i18n.Load(translations)
+	if err != nil {
+		return err
+	}
+	c.Templates, c.MailTemplates, c.Static, c.Catalog = templates, mailTemplates, static, catalog
 	return nil
 }
 
+// With returns a copy of the configuration with replaced database connections pool,
+// errors logger and clock, nil values are not replaced.
+// The copy shares resources with the original, so only one of them should be closed.
+func (c *Cfg) With(pool db.Pool, logger *log.Logger, clock func() time.Time) *Cfg {
+	x := *c
+	if pool != nil {
+		x.pool = pool
+	}
+	if logger != nil {
+		x.logger = logger
+	}
+	if clock != nil {
+		x.clock = clock
+	}
+	return &x
+}
+
+// Logger returns errors logger, it's the standard one by default.
+func (c *Cfg) Logger() *log.Logger {
+	if c.logger == nil {
+		return log.Default()
+	}
+	return c.logger
+}
+
+// Now returns current time using configured clock.
+func (c *Cfg) Now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock()
+}
+
 // Connection return new database connection.
 func (c *Cfg) Connection() redis.Conn {
 	return c.pool.Get()
@@ -22,3 +22,104 @@ func TestNew(t *testing.T) {
 		t.Errorf("close error: %v", err)
 	}
 }
+
+func TestCfg_setHeaders(t *testing.T) {
+	c := &Cfg{Headers: map[string]string{
+		"x-frame-options": "SAMEORIGIN",
+		"Cache-Control":   "",
+		"X-Custom":        "test",
+	}}
+	c.setHeaders()
+	expected := map[string]string{
+		"X-Frame-Options":         "SAMEORIGIN",
+		"X-Custom":                "test",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": defaultHeaders["Content-Security-Policy"],
+	}
+	for name, value := range expected {
+		if h := c.Headers[name]; h != value {
+			t.Errorf("failed header %v: %v", name, h)
+		}
+	}
+	if _, ok := c.Headers["Cache-Control"]; ok {
+		t.Error("disabled header exists")
+	}
+}
+
+func TestCfg_isValid(t *testing.T) {
+	cases := []struct {
+		minTTL     int
+		ttl        int
+		maxContent int
+		quota      int
+		formTTL    int
+		ok         bool
+	}{
+		{minTTL: 0, ttl: 60, formTTL: 60, ok: true},
+		{minTTL: 60, ttl: 60, formTTL: 60, ok: true},
+		{minTTL: 1, ttl: 7 * 86400, formTTL: 86400, ok: true},
+		{minTTL: 2 * 86400, ttl: 7 * 86400, formTTL: 2 * 86400, ok: true},
+		{minTTL: 61, ttl: 60, ok: false},
+		{minTTL: -1, ttl: 60, ok: false},
+		{minTTL: 1, ttl: 60, maxContent: 1 << 30, ok: false},
+		{minTTL: 1, ttl: 60, maxContent: -1, ok: false},
+		{minTTL: 1, ttl: 60, quota: -1, ok: false},
+	}
+	for i, v := range cases {
+		c, err := New(testConfigName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+		c.Templates = nil
+		c.Settings.MinTTL, c.Settings.TTL = v.minTTL, v.ttl
+		c.Settings.MaxContent, c.Settings.Quota.Count = v.maxContent, v.quota
+		err = c.isValid()
+		if v.ok {
+			if err != nil {
+				t.Errorf("unexpected error case=%v: %v", i, err)
+			}
+			if c.Settings.MinTTL < 1 {
+				t.Errorf("failed min_ttl case=%v: %v", i, c.Settings.MinTTL)
+			}
+			if c.Settings.FormTTL != v.formTTL {
+				t.Errorf("failed form ttl case=%v: %v", i, c.Settings.FormTTL)
+			}
+		} else if err == nil {
+			t.Errorf("expected error case=%v", i)
+		}
+		err = c.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}
+}
+
+func TestCfg_setBasePath(t *testing.T) {
+	cases := map[string]string{
+		"":               "/",
+		"/":              "/",
+		"enigma":         "/enigma/",
+		" /enigma/ ":     "/enigma/",
+		"/tools//enigma": "/tools/enigma/",
+		"/a?b":           "",
+	}
+	for value, expected := range cases {
+		c := &Cfg{BasePath: value}
+		err := c.setBasePath()
+		if expected == "" {
+			if err == nil {
+				t.Errorf("expected error for %q", value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", value, err)
+		} else if c.BasePath != expected {
+			t.Errorf("failed base path for %q: %v", value, c.BasePath)
+		}
+	}
+}
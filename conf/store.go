@@ -0,0 +1,99 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/z0rr0/enigma/audit"
+	"github.com/z0rr0/enigma/db"
+)
+
+// Store keeps the current configuration and reloads it from the file.
+// Every configuration is an immutable snapshot, so a request can use one
+// until it's finished, even if new configuration is loaded meanwhile.
+type Store struct {
+	// ErrorLog is a logger of background errors, the standard one is used if it's nil.
+	ErrorLog *log.Logger
+	filename string
+	delay    time.Duration
+	current  atomic.Pointer[Cfg]
+	mu       sync.Mutex
+}
+
+// NewStore returns new configuration store for the file.
+func NewStore(filename string) (*Store, error) {
+	cfg, err := New(filename)
+	if err != nil {
+		return nil, err
+	}
+	// server timeouts are not reloaded, so the first one limits requests duration
+	s := &Store{filename: filename, delay: cfg.HandleTimeout()}
+	s.current.Store(cfg)
+	return s, nil
+}
+
+// Cfg returns the current configuration.
+func (s *Store) Cfg() *Cfg {
+	return s.current.Load()
+}
+
+// Reload replaces the current configuration by new one from the file.
+// Redis connections pool is reused if its settings are not changed.
+// The old configuration is closed when its requests are finished,
+// and it's kept if new one is invalid.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := Read(s.filename)
+	if err != nil {
+		return err
+	}
+	old := s.current.Load()
+	shared := old.Redis.Equal(cfg.Redis)
+	if shared {
+		cfg.pool = old.pool
+	} else {
+		cfg.pool, err = db.GetDbPool(cfg.Redis)
+		if err != nil {
+			if e := cfg.close(false); e != nil {
+				return e
+			}
+			return err
+		}
+	}
+	s.current.Store(cfg)
+	time.AfterFunc(s.delay, func() {
+		if err := old.close(!shared); err != nil {
+			s.logf("failed close old configuration: %v", err)
+		}
+	})
+	return nil
+}
+
+// LogExpired writes audit event about expired item using the current configuration,
+// because audit sinks of old ones are closed after reloading.
+func (s *Store) LogExpired(key string) error {
+	cfg := s.Cfg()
+	return cfg.Audit.Log(key, &audit.Event{Action: audit.ActionExpire}, cfg.Now())
+}
+
+// logf writes background error message.
+func (s *Store) logf(format string, v ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+// Close frees resources of the current configuration.
+func (s *Store) Close() error {
+	return s.current.Load().Close()
+}
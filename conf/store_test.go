@@ -0,0 +1,221 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/audit"
+	"github.com/z0rr0/enigma/db"
+)
+
+// writeConfig writes test configuration file with changed settings and redis max connections.
+func writeConfig(t *testing.T, name string, ttl, maxCon int) {
+	data, err := ioutil.ReadFile(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Cfg{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Settings.TTL, c.Redis.MaxCon = ttl, maxCon
+	data, err = json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(name, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enigma-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed remove %v: %v", dir, err)
+		}
+	}()
+	name := filepath.Join(dir, "config.json")
+	writeConfig(t, name, 600, 4)
+
+	s, err := NewStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	s.delay = 10 * time.Millisecond
+	first := s.Cfg()
+
+	// only settings are changed
+	writeConfig(t, name, 900, 4)
+	err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := s.Cfg()
+	if (second == first) || (second.Settings.TTL != 900) || (first.Settings.TTL != 600) {
+		t.Errorf("failed settings reload: %v", second.Settings.TTL)
+	}
+	if second.pool != first.pool {
+		t.Error("pool is not reused")
+	}
+	// invalid configuration keeps the current one
+	err = ioutil.WriteFile(name, []byte("{"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Reload(); err == nil {
+		t.Error("expected error for invalid configuration")
+	}
+	if s.Cfg() != second {
+		t.Error("invalid configuration is loaded")
+	}
+	// redis settings are changed, so new pool is used
+	writeConfig(t, name, 900, 8)
+	err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	third := s.Cfg()
+	if third.pool == second.pool {
+		t.Error("pool is not replaced")
+	}
+	// the old pool is still available for active requests
+	conn := second.Connection()
+	_, err = conn.Do("PING")
+	if err != nil {
+		t.Errorf("old pool is closed: %v", err)
+	}
+	if err = conn.Close(); err != nil {
+		t.Errorf("close connection error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	conn = second.Connection()
+	if _, err = conn.Do("PING"); err == nil {
+		t.Error("old pool is not closed")
+	}
+	_ = conn.Close()
+	conn = third.Connection()
+	if _, err = conn.Do("PING"); err != nil {
+		t.Errorf("current pool is failed: %v", err)
+	}
+	if err = conn.Close(); err != nil {
+		t.Errorf("close connection error: %v", err)
+	}
+}
+
+func TestStore_LogExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enigma-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed remove %v: %v", dir, err)
+		}
+	}()
+	data, err := ioutil.ReadFile(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]interface{})
+	if err = json.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	logName := filepath.Join(dir, "audit.log")
+	values["audit"] = map[string]string{"sink": "file", "path": logName}
+	if data, err = json.Marshal(values); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	s.delay = time.Millisecond
+	old := s.Cfg()
+	// the watcher is started before reloading, like in the main program,
+	// its own connection is used, because pooled one can't be closed during receiving
+	conn, err := redis.Dial("tcp", old.Redis.RedisAddr(), redis.DialPassword(old.Redis.Password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := make(chan error, 1)
+	go func() {
+		_ = db.WatchExpired(conn, old.Redis.Db, func(key string) {
+			logged <- s.LogExpired(key)
+		})
+	}()
+	if err = s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// the old audit sink is closed after the delay
+	time.Sleep(50 * time.Millisecond)
+	if err = old.Audit.Log("old", &audit.Event{Action: audit.ActionExpire}, old.Now()); err == nil {
+		t.Error("old audit sink is not closed")
+	}
+	other := s.Cfg().Connection()
+	defer func() {
+		if err := other.Close(); err != nil {
+			t.Errorf("close connection error: %v", err)
+		}
+	}()
+	channel := fmt.Sprintf("__keyevent@%d__:expired", old.Redis.Db)
+	for i := 0; ; i++ {
+		n, err := redis.Values(other.Do("PUBSUB", "NUMSUB", channel))
+		if (err == nil) && (len(n) == 2) && (n[1].(int64) == 1) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("no subscription: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the same notification as Redis sends for expired item
+	_, err = other.Do("PUBLISH", channel, "expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-logged:
+		if err != nil {
+			t.Fatalf("expired item is not logged after reload: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expired item is not received")
+	}
+	if err = conn.Close(); err != nil {
+		t.Errorf("close connection error: %v", err)
+	}
+	data, err = ioutil.ReadFile(logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"action":"expire"`) || !strings.Contains(string(data), s.Cfg().Audit.Hash("expired")) {
+		t.Errorf("failed audit log: %s", data)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// CodePrefix is a prefix of item's keys for passphrase codes,
+	// such keys are not valid for links, so codes are available only using rate limited form.
+	CodePrefix = "code:"
+	// CodeWords is a number of words in a passphrase code.
+	CodeWords = 3
+
+	// limitPrefix is a prefix of rate limit counters keys.
+	limitPrefix = "limit:"
+)
+
+var (
+	// limitScript increments a counter KEYS[1] by ARGV[2], sets its TTL ARGV[1] for new one
+	// and returns a counter value.
+	limitScript = redis.NewScript(1, `
+local n = redis.call('INCRBY', KEYS[1], ARGV[2])
+if n == tonumber(ARGV[2]) then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+	// uncountScript decrements existing counter KEYS[1] by ARGV[1] and returns its value,
+	// expired counter is not created again.
+	uncountScript = redis.NewScript(1, `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+return redis.call('DECRBY', KEYS[1], ARGV[1])
+`)
+	// codeReplacer converts typed separators of code words to the default one.
+	codeReplacer = strings.NewReplacer(" ", wordsSeparator, "_", wordsSeparator, ".", wordsSeparator)
+)
+
+// NewCode returns new random passphrase code like "tango-lamp-river-7".
+// It has 256^3*10 (about 27 bits of entropy) variants, so codes lookup should be rate limited.
+func NewCode() (string, error) {
+	b := make([]byte, CodeWords)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	digit, err := rand.Int(rand.Reader, big.NewInt(10))
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, CodeWords+1)
+	for i, c := range b {
+		parts[i] = words[c]
+	}
+	parts[CodeWords] = digit.String()
+	return strings.Join(parts, wordsSeparator), nil
+}
+
+// CodeKey returns item's key for a typed passphrase code.
+// The code is case insensitive and its words can be separated by spaces.
+// It returns false if the code is invalid.
+func CodeKey(code string) (string, bool) {
+	code = codeReplacer.Replace(strings.ToLower(strings.TrimSpace(code)))
+	parts := strings.FieldsFunc(code, func(r rune) bool {
+		return string(r) == wordsSeparator
+	})
+	if len(parts) != CodeWords+1 {
+		return "", false
+	}
+	for _, p := range parts[:CodeWords] {
+		if !wordIndex[p] {
+			return "", false
+		}
+	}
+	if d := parts[CodeWords]; (len(d) != 1) || (d[0] < '0') || (d[0] > '9') {
+		return "", false
+	}
+	return CodePrefix + strings.Join(parts, wordsSeparator), true
+}
+
+// newKey returns new item's key, it's a passphrase code or a random one by the item's format.
+func (item *Item) newKey() (string, error) {
+	if !item.Code {
+		return item.Format.NewKey()
+	}
+	code, err := NewCode()
+	if err != nil {
+		return "", err
+	}
+	return CodePrefix + code, nil
+}
+
+// RateLimit counts an event with a name and returns false if there were more than
+// limit events during window seconds since the first one.
+func RateLimit(c redis.Conn, name string, limit, window int) (bool, error) {
+	return RateLimitN(c, name, 1, limit, window)
+}
+
+// RateLimitN counts n events with a name at once like RateLimit.
+func RateLimitN(c redis.Conn, name string, n, limit, window int) (bool, error) {
+	if limit < 1 {
+		return false, errors.New("invalid rate limit parameters")
+	}
+	total, err := Count(c, name, n, window)
+	if err != nil {
+		return false, err
+	}
+	return total <= limit, nil
+}
+
+// Count counts n events with a name and returns a number of them
+// during window seconds since the first one.
+func Count(c redis.Conn, name string, n, window int) (int, error) {
+	if (n < 1) || (window < 1) {
+		return 0, errors.New("invalid rate limit parameters")
+	}
+	key := limitPrefix + name
+	err := bind(c, key)
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int(limitScript.Do(c, key, window, n))
+}
+
+// Uncount removes n events with a name counted before, for example, if they failed.
+func Uncount(c redis.Conn, name string, n int) error {
+	if n < 1 {
+		return nil
+	}
+	key := limitPrefix + name
+	err := bind(c, key)
+	if err != nil {
+		return err
+	}
+	_, err = uncountScript.Do(c, key, n)
+	return err
+}
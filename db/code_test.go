@@ -0,0 +1,120 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestCodeKey(t *testing.T) {
+	for i := 0; i < 32; i++ {
+		code, err := NewCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(code, wordsSeparator); n != CodeWords {
+			t.Errorf("failed code %v", code)
+		}
+		key, ok := CodeKey(code)
+		if !ok || (key != CodePrefix+code) {
+			t.Errorf("failed code key %v: %v", code, key)
+		}
+		if keys := KeyCandidates(key); len(keys) != 0 {
+			t.Errorf("code is available by link: %v", keys)
+		}
+	}
+	cases := []struct {
+		code string
+		key  string
+	}{
+		{code: ""},
+		{code: "tango-lamp-river"},
+		{code: "lamp-river-rope-77"},
+		{code: "lamp-river-unknown-7"},
+		{code: "lamp-river-rope-x"},
+		{code: "lamp-river-rope-7", key: CodePrefix + "lamp-river-rope-7"},
+		{code: " Lamp River  ROPE 7 ", key: CodePrefix + "lamp-river-rope-7"},
+		{code: "lamp_river.rope--7", key: CodePrefix + "lamp-river-rope-7"},
+	}
+	for i, c := range cases {
+		key, ok := CodeKey(c.code)
+		if (key != c.key) || (ok != (c.key != "")) {
+			t.Errorf("failed case=%v: %v", i, key)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	defer func() {
+		_, err = conn.Do("DEL", limitPrefix+"test")
+		if err != nil {
+			t.Errorf("failed delete counter: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	if _, err = RateLimit(conn, "test", 0, 10); err == nil {
+		t.Error("expected error for invalid limit")
+	}
+	for i := 1; i <= 5; i++ {
+		ok, err := RateLimit(conn, "test", 3, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (i <= 3) {
+			t.Errorf("failed limit check %v", i)
+		}
+	}
+	if _, err = RateLimitN(conn, "test", 0, 3, 10); err == nil {
+		t.Error("expected error for invalid number of events")
+	}
+	_, err = conn.Do("DEL", limitPrefix+"test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range []int{2, 1, 1} {
+		ok, err := RateLimitN(conn, "test", n, 3, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (i < 2) {
+			t.Errorf("failed limit check of %v events", i)
+		}
+	}
+	ttl, err := redis.Int(conn.Do("TTL", limitPrefix+"test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (ttl < 1) || (ttl > 10) {
+		t.Errorf("failed counter ttl %v", ttl)
+	}
+	// refunded events are available again, the counter keeps its TTL
+	if err = Uncount(conn, "test", 2); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := RateLimitN(conn, "test", 1, 3, 10); err != nil || !ok {
+		t.Errorf("failed limit check after refund: %v", err)
+	}
+	if ttl, err = redis.Int(conn.Do("TTL", limitPrefix+"test")); (err != nil) || (ttl < 1) {
+		t.Errorf("failed counter ttl after refund %v: %v", ttl, err)
+	}
+	// expired counter is not created by refund
+	if err = Uncount(conn, "test-absent", 1); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int(conn.Do("EXISTS", limitPrefix+"test-absent")); (err != nil) || (n != 0) {
+		t.Errorf("refund created counter: %v", err)
+	}
+}
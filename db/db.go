@@ -11,6 +11,7 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha512"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,7 +19,9 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -34,6 +37,51 @@ const (
 	fieldContent  = "content"
 	fieldPassword = "password"
 	fieldTimes    = "times"
+	fieldCreator  = "creator"
+	fieldOwners   = "owners"
+
+	// read script statuses
+	readNotFound    = 0
+	readBadPassword = 1
+	readOk          = 2
+)
+
+var (
+	// ErrPassword is an error for failed item's password.
+	ErrPassword = errors.New("failed password")
+
+	// saveScript creates new item KEYS[1] only if the key doesn't exist yet,
+	// ARGV are content, password hash, a number of readings, TTL, creator identity
+	// and quotas owners separated by new lines.
+	// It returns 1 if the item is saved and 0 for a key collision.
+	saveScript = redis.NewScript(1, `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'content', ARGV[1], 'password', ARGV[2], 'times', ARGV[3], 'creator', ARGV[5], 'owners', ARGV[6])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+	// readScript checks password hash ARGV[1] of item KEYS[1],
+	// decrements its readings counter and returns content, a number of remaining readings and quotas owners.
+	// The item is deleted after the last reading, so no empty hash can be left.
+	readScript = redis.NewScript(1, `
+local h = redis.call('HGET', KEYS[1], 'password')
+if not h then
+	return {0}
+end
+if h ~= ARGV[1] then
+	return {1}
+end
+local times = redis.call('HINCRBY', KEYS[1], 'times', -1)
+local content = redis.call('HGET', KEYS[1], 'content')
+local owners = redis.call('HGET', KEYS[1], 'owners') or ''
+if times <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return {2, content, times, owners}
+`)
 )
 
 // Item is data for new saving.
@@ -43,25 +91,43 @@ type Item struct {
 	Times     int
 	Password  string
 	Key       string
+	Format    *KeyFormat
+	Code      bool
+	Creator   string
+	Owners    []string
 	eContent  string
 	hPassword string
 }
 
 // Cfg is configuration redis settings.
 type Cfg struct {
-	Host     string `json:"host"`
-	Port     uint   `json:"port"`
-	Network  string `json:"network"`
-	Db       int    `json:"db"`
-	Timeout  int64  `json:"timeout"`
-	Password string `json:"password"`
-	IndleCon int    `json:"indlecon"`
-	MaxCon   int    `json:"maxcon"`
-	timeout  time.Duration
+	Mode             string   `json:"mode"`
+	Host             string   `json:"host"`
+	Port             uint     `json:"port"`
+	Network          string   `json:"network"`
+	Addrs            []string `json:"addrs"`
+	Master           string   `json:"master"`
+	SentinelPassword string   `json:"sentinel_password"`
+	Db               int      `json:"db"`
+	Timeout          int64    `json:"timeout"`
+	Username         string   `json:"username"`
+	Password         string   `json:"password"`
+	TLS              *TLSCfg  `json:"tls"`
+	IndleCon         int      `json:"indlecon"`
+	MaxCon           int      `json:"maxcon"`
+	timeout          time.Duration
+	tlsConfig        *tls.Config
+}
+
+// Pool is a source of database connections.
+type Pool interface {
+	Get() redis.Conn
+	Close() error
 }
 
 // GetDbPool creates new Redis db connections pool.
-func GetDbPool(c *Cfg) (*redis.Pool, error) {
+// Single server, Sentinel and Cluster modes are supported.
+func GetDbPool(c *Cfg) (Pool, error) {
 	if c.Timeout < 1 {
 		return nil, errors.New("invalid redis timeout value")
 	}
@@ -72,30 +138,41 @@ func GetDbPool(c *Cfg) (*redis.Pool, error) {
 	if c.Db < 0 {
 		return nil, errors.New("invalid db number")
 	}
-	pool := &redis.Pool{
-		MaxIdle:     c.IndleCon,
-		MaxActive:   c.MaxCon,
-		IdleTimeout: c.timeout,
-		Wait:        true,
-		Dial: func() (redis.Conn, error) {
-			return redis.Dial(
-				c.Network,
-				c.RedisAddr(),
-				redis.DialConnectTimeout(c.timeout),
-				redis.DialDatabase(c.Db),
-				redis.DialPassword(c.Password),
-			)
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if time.Since(t) < time.Minute {
-				return nil
-			}
-			_, err := c.Do("PING")
-			return err
-		},
+	err := c.checkNetwork()
+	if err != nil {
+		return nil, err
+	}
+	c.tlsConfig, err = c.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	var pool Pool
+	switch c.Mode {
+	case "", ModeSingle:
+		pool = c.newPool(func() (redis.Conn, error) {
+			return redis.Dial(c.Network, c.RedisAddr(), c.dialOptions()...)
+		}, testPing)
+	case ModeSentinel:
+		if (len(c.Addrs) == 0) || (c.Master == "") {
+			return nil, errors.New("sentinel addresses and master name are required")
+		}
+		pool = c.newPool(c.dialMaster, testIdleMaster)
+	case ModeCluster:
+		if len(c.Addrs) == 0 {
+			return nil, errors.New("cluster addresses are required")
+		}
+		if c.Db != 0 {
+			return nil, errors.New("cluster supports only db 0")
+		}
+		pool, err = c.newCluster()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown redis mode %v", c.Mode)
 	}
 	conn := pool.Get()
-	_, err := conn.Do("PING")
+	_, err = conn.Do("PING")
 	if err != nil {
 		return nil, err
 	}
@@ -107,10 +184,31 @@ func GetDbPool(c *Cfg) (*redis.Pool, error) {
 }
 
 // RedisAddr returns redis service's net address.
+// It is a socket path for unix network.
 func (c *Cfg) RedisAddr() string {
+	if c.Network == "unix" {
+		return c.Host
+	}
 	return net.JoinHostPort(c.Host, fmt.Sprint(c.Port))
 }
 
+// Equal returns true if other settings are the same, so a connections pool can be reused.
+// Settings with enabled TLS are never equal, because certificate files can be changed.
+func (c *Cfg) Equal(other *Cfg) bool {
+	if (c == nil) || (other == nil) || c.withTLS() || other.withTLS() {
+		return false
+	}
+	a, b := *c, *other
+	a.timeout, a.tlsConfig = 0, nil
+	b.timeout, b.tlsConfig = 0, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// withTLS returns true if TLS connections are enabled.
+func (c *Cfg) withTLS() bool {
+	return (c.TLS != nil) && c.TLS.Enabled
+}
+
 // IsOk checks db is available using redis PING command.
 func IsOk(conn redis.Conn) bool {
 	resp, err := redis.String(conn.Do("PING"))
@@ -120,76 +218,88 @@ func IsOk(conn redis.Conn) bool {
 	return resp == "PONG"
 }
 
-// Save saves the item to database.
+// Reserver accepts new item before its saving, for example checking quotas.
+// Release is called for accepted item if it is not saved.
+type Reserver interface {
+	Reserve(item *Item, size int) (bool, error)
+	Release(item *Item)
+}
+
+// Save saves the item to database. New unique key reservation
+// and all item's fields writing are done by one atomic script call.
 func (item *Item) Save(c redis.Conn, skey []byte) error {
-	key, err := generateKey(c)
-	if err != nil {
-		return err
-	}
-	item.Key = key
+	_, err := item.SaveReserved(c, skey, nil)
+	return err
+}
 
-	err = item.hashPassword()
-	if err != nil {
-		return err
-	}
-	err = item.encrypt(skey)
-	if err != nil {
-		return err
-	}
-	err = c.Send("MULTI")
-	if err != nil {
-		return err
-	}
-	err = c.Send("HSET", item.Key, fieldContent, item.eContent)
-	if err != nil {
-		return err
-	}
-	err = c.Send("HSET", item.Key, fieldPassword, item.hPassword)
-	if err != nil {
-		return err
-	}
-	err = c.Send("HSET", item.Key, fieldTimes, item.Times)
+// SaveReserved saves the item like Save, but every attempt to store it with new key
+// should be accepted by r with the size of stored encrypted content before writing.
+// It returns false if the item is not accepted, r can be nil.
+func (item *Item) SaveReserved(c redis.Conn, skey []byte, r Reserver) (bool, error) {
+	err := item.encrypt(skey)
 	if err != nil {
-		return err
-	}
-	err = c.Send("EXPIRE", item.Key, item.TTL)
-	if err != nil {
-		return err
-	}
-	r, err := c.Do("EXEC")
-	if err != nil {
-		return err
-	}
-	result, ok := r.([]interface{})
-	if !ok {
-		return errors.New("failed multi read result convertion")
-	}
-	if len(result) != 4 { // 4 operations: 3 hset + expire
-		return errors.New("unexpected multi item result")
+		return false, err
 	}
-	for i, v := range result {
-		ok, err = redis.Bool(v, nil)
+	// loop to exclude collisions
+	for i := 0; i < maxCollisions; i++ {
+		item.Key, err = item.newKey()
+		if err != nil {
+			return false, err
+		}
+		err = item.hashPassword()
 		if err != nil {
-			return fmt.Errorf("failed operation=%v bool convertion", i)
+			return false, err
+		}
+		if r != nil {
+			ok, err := r.Reserve(item, len(item.eContent))
+			if err != nil || !ok {
+				item.Key = ""
+				return false, err
+			}
 		}
-		if !ok {
-			return fmt.Errorf("failed operation=%v result", i)
+		ok, err := item.store(c)
+		if (r != nil) && (err != nil || !ok) {
+			r.Release(item)
+		}
+		if err != nil {
+			item.Key = ""
+			return false, err
+		}
+		if ok {
+			return true, nil
 		}
 	}
-	return nil
+	item.Key = ""
+	return false, fmt.Errorf("can not get an unique key [%v] after %v attempts", item.Format, maxCollisions)
 }
 
-// GetURL returns item's URL.
-func (item *Item) GetURL(r *http.Request, secure bool) *url.URL {
+// store writes the item if its key is not used yet.
+func (item *Item) store(c redis.Conn) (bool, error) {
+	// script hash is not a key, so cluster connection should be bound before
+	err := bind(c, item.Key)
+	if err != nil {
+		return false, err
+	}
+	return redis.Bool(saveScript.Do(c, item.Key, item.eContent, item.hPassword, item.Times, item.TTL, item.Creator, strings.Join(item.Owners, ownersSeparator)))
+}
+
+// GetURL returns item's URL for the service with base path prefix.
+// Passphrase codes are not available by links, so codes lookup page URL is returned for them.
+func (item *Item) GetURL(r *http.Request, secure bool, base string) *url.URL {
 	// r.URL.Scheme is blank, so use hint from settings
 	scheme := "http"
 	if secure {
 		scheme = "https"
 	}
+	path := item.Key
+	if strings.HasPrefix(path, CodePrefix) {
+		path = "code"
+	}
+	path = strings.TrimSuffix(base, "/") + "/" + path
 	return &url.URL{
 		Scheme: scheme,
 		Host:   r.Host,
-		Path:   item.Key,
+		Path:   path,
 	}
 }
 
@@ -223,17 +333,22 @@ func (item *Item) encrypt(skey []byte) error {
 	key := item.cipherKey(skey)
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil
+		return err
 	}
-	plainText := []byte(item.Content)
-	cipherText := make([]byte, aes.BlockSize+len(plainText))
-	iv := cipherText[:aes.BlockSize]
+	plainText, flags := []byte(item.Content), byte(0)
+	if compressed, ok := compress(plainText); ok {
+		plainText, flags = compressed, flagCompressed
+	}
+	cipherText := make([]byte, headerLen+aes.BlockSize+len(plainText))
+	cipherText[0], cipherText[1] = formatVersion, flags
+	iv := cipherText[headerLen : headerLen+aes.BlockSize]
 	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
 		return errors.New("iv random generation error")
 	}
 	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(cipherText[aes.BlockSize:], plainText)
-	item.eContent = hex.EncodeToString(cipherText)
+	stream.XORKeyStream(cipherText[headerLen+aes.BlockSize:], plainText)
+	// raw bytes are stored, Redis strings are binary safe
+	item.eContent = string(cipherText)
 	return nil
 }
 
@@ -242,7 +357,7 @@ func (item *Item) decrypt(skey []byte) error {
 	if item.eContent == "" {
 		return errors.New("empty cipherText")
 	}
-	cipherText, err := hex.DecodeString(item.eContent)
+	cipherText, flags, err := unpack(item.eContent)
 	if err != nil {
 		return err
 	}
@@ -259,50 +374,73 @@ func (item *Item) decrypt(skey []byte) error {
 	stream := cipher.NewCFBDecrypter(block, iv)
 	stream.XORKeyStream(cipherText, cipherText)
 
+	if flags&flagCompressed != 0 {
+		cipherText, err = decompress(cipherText)
+		if err != nil {
+			return err
+		}
+	}
 	item.Content = string(cipherText)
 	return nil
 }
 
-// Read gets data from database. Expected it is called after Exists and CheckPassword.
+// Read gets data from database. It checks item's password,
+// decrements a number of available readings and deletes the item after the last one.
+// All this is done atomically by one server-side script call,
+// so concurrent readings can't get the data more times than it's allowed.
+// It returns ErrPassword for failed password and false if item doesn't exist.
 func (item *Item) Read(c redis.Conn, skey []byte) (bool, error) {
 	if item.Key == "" {
 		return false, nil
 	}
-	// redis increment is an atomic operation
-	times, err := redis.Int(c.Do("HINCRBY", item.Key, fieldTimes, -1))
-	if err != nil {
-		return false, err
-	}
-	if times < 0 {
-		// probably concurrent request is reading the item at the same time
-		ok, err := item.Exists(c)
+	if item.hPassword == "" {
+		err := item.hashPassword()
 		if err != nil {
 			return false, err
 		}
-		if !ok {
-			// one doesn't exist but HINCRBY called after deleting creates a new record
-			_, err = item.delete(c)
-			return false, err
-		}
-		// item will be deleted by the first concurrent reading
-		return false, nil
 	}
-	content, err := redis.String(c.Do("HGET", item.Key, fieldContent))
+	err := bind(c, item.Key)
 	if err != nil {
 		return false, err
 	}
-	if times == 0 {
-		// no new attempts for read
-		ok, err := item.delete(c)
-		if err != nil {
-			return false, err
-		}
-		if !ok {
-			return false, fmt.Errorf("item=%v was not deleted", item.Key)
+	values, err := redis.Values(readScript.Do(c, item.Key, item.hPassword))
+	if err != nil {
+		return false, err
+	}
+	if len(values) == 0 {
+		return false, errors.New("empty read script result")
+	}
+	status, err := redis.Int(values[0], nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case readNotFound:
+		return false, nil
+	case readBadPassword:
+		return false, ErrPassword
+	case readOk:
+		if len(values) != 4 {
+			return false, errors.New("unexpected read script result")
 		}
+	default:
+		return false, fmt.Errorf("unknown read script status=%v", status)
+	}
+	content, err := redis.String(values[1], nil)
+	if err != nil {
+		return false, err
+	}
+	times, err := redis.Int(values[2], nil)
+	if err != nil {
+		return false, err
+	}
+	owners, err := redis.String(values[3], nil)
+	if err != nil {
+		return false, err
 	}
 	item.Times = times
 	item.eContent = content
+	item.Owners = splitOwners(owners)
 
 	err = item.decrypt(skey)
 	if err != nil {
@@ -328,6 +466,45 @@ func (item *Item) Exists(c redis.Conn) (bool, error) {
 	return exists, nil
 }
 
+// Status loads item's remaining readings, creator and quotas owners without content reading.
+// It returns false if the item doesn't exist.
+func (item *Item) Status(c redis.Conn) (bool, error) {
+	values, err := redis.Values(c.Do("HMGET", item.Key, fieldTimes, fieldCreator, fieldOwners))
+	if err != nil {
+		return false, err
+	}
+	if values[0] == nil {
+		return false, nil
+	}
+	item.Times, err = redis.Int(values[0], nil)
+	if err != nil {
+		return false, err
+	}
+	item.Creator, err = redis.String(values[1], nil)
+	if (err != nil) && (err != redis.ErrNil) {
+		return false, err
+	}
+	owners, err := redis.String(values[2], nil)
+	if (err != nil) && (err != redis.ErrNil) {
+		return false, err
+	}
+	item.Owners = splitOwners(owners)
+	return true, nil
+}
+
+// Expiration returns item's expiration time since now.
+func (item *Item) Expiration(c redis.Conn, now time.Time) (time.Time, error) {
+	ttl, err := redis.Int64(c.Do("PTTL", item.Key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ttl < 0 {
+		// -2 if key doesn't exist and -1 if it has no expiration
+		return time.Time{}, fmt.Errorf("item=%v has no expiration", item.Key)
+	}
+	return now.Add(time.Duration(ttl) * time.Millisecond), nil
+}
+
 // CheckPassword checks that password is correct.
 func (item *Item) CheckPassword(c redis.Conn) (bool, error) {
 	var err error
@@ -358,40 +535,6 @@ func (item *Item) hashPassword() error {
 	return nil
 }
 
-// generateKey generates unique random key for an item.
-func generateKey(c redis.Conn) (string, error) {
-	var (
-		key string
-		err error
-	)
-	// loop to exclude collisions
-	for i := 0; i < maxCollisions; i++ {
-		key, err = getKey()
-		if err != nil {
-			return "", err
-		}
-		// check that key doesn't exist before
-		exists, err := redis.Bool(c.Do("HEXISTS", key, fieldContent))
-		if err != nil {
-			return "", err
-		}
-		if !exists {
-			return key, nil
-		}
-	}
-	return "", fmt.Errorf("can not get an unique key [%v] after %v attemps", KeyLen, maxCollisions)
-}
-
-// getKey returns string random key.
-func getKey() (string, error) {
-	var b [KeyLen]byte
-	_, err := rand.Read(b[:])
-	if err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(b[:]), nil
-}
-
 // validateRange converts value to integer and checks that it is in a range [1; max].
 func validateRange(value, field string, max int) (int, error) {
 	n, err := strconv.Atoi(value)
@@ -405,32 +548,46 @@ func validateRange(value, field string, max int) (int, error) {
 }
 
 // New checks POST form data anb returns new item for saving.
-func New(r *http.Request, ttl, times int) (*Item, error) {
+// Item's TTL should be in a range [minTTL; maxTTL] seconds, now is used for expiration time values.
+func New(r *http.Request, now time.Time, minTTL, maxTTL, times int) (*Item, error) {
+	return NewFrom(r.PostFormValue, now, minTTL, maxTTL, times)
+}
+
+// NewFrom checks fields data returned by value function and returns new item for saving.
+// Field names are the same as for POST form of New.
+func NewFrom(value func(field string) string, now time.Time, minTTL, maxTTL, times int) (*Item, error) {
 	// text content
-	content := r.PostFormValue("content")
+	content := value("content")
 	if content == "" {
 		return nil, errors.New("required field content")
 	}
 	// TTL
-	value := r.PostFormValue("ttl")
-	if value == "" {
+	field := value("ttl")
+	if field == "" {
 		return nil, errors.New("required field ttl")
 	}
-	ttl, err := validateRange(value, "ttl", ttl)
+	ttl, err := ParseTTL(field, now, minTTL, maxTTL)
 	if err != nil {
 		return nil, err
 	}
 	// times
-	value = r.PostFormValue("times")
-	if value == "" {
+	field = value("times")
+	if field == "" {
 		return nil, errors.New("required field times")
 	}
-	attempts, err := validateRange(value, "times", times)
+	attempts, err := validateRange(field, "times", times)
 	if err != nil {
 		return nil, err
 	}
+	// optional recipient's public key, the server stores only encrypted to it content
+	if recipient := value("recipient"); recipient != "" {
+		content, err = EncryptTo(recipient, content)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// password
-	password := r.PostFormValue("password")
+	password := value("password")
 	item := &Item{
 		Content:  content,
 		TTL:      ttl,
@@ -2,12 +2,14 @@ package db
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -30,7 +32,7 @@ type testCfg struct {
 	Redis *Cfg `json:"redis"`
 }
 
-func readCfg() (*redis.Pool, error) {
+func readCfg() (Pool, error) {
 	jsonData, err := ioutil.ReadFile(testConfigName)
 	if err != nil {
 		return nil, err
@@ -98,6 +100,7 @@ func TestGetDbPool(t *testing.T) {
 
 func TestItem_New(t *testing.T) {
 	const (
+		minTTL   = 10
 		maxTTL   = 300
 		maxTimes = 10
 	)
@@ -105,7 +108,14 @@ func TestItem_New(t *testing.T) {
 		// content, ttl, times, ok
 		{"test", "100", "1", "1"},
 		{"test", "300", "1", "1"},
+		{"test", "5m", "1", "1"},
+		{"test", "10s", "1", "1"},
+		{"test", time.Now().Add(2 * time.Minute).Format(time.RFC3339), "1", "1"},
+		{"test", time.Now().Add(-2 * time.Minute).Format(time.RFC3339), "1", "0"},
 		{"test", "330", "1", "0"},
+		{"test", "6m", "1", "0"},
+		{"test", "1d", "1", "0"},
+		{"test", "9", "1", "0"},
 		{"test", "0", "1", "0"},
 		{"test", "100", "0", "0"},
 		{"test", "100", "11", "0"},
@@ -126,7 +136,7 @@ func TestItem_New(t *testing.T) {
 		r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
 		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-		item, err := New(r, maxTTL, maxTimes)
+		item, err := New(r, time.Now(), minTTL, maxTTL, maxTimes)
 		if v[3] == "1" {
 			if err != nil {
 				t.Errorf("unexpected error for case=%v: %v", i, err)
@@ -152,15 +162,25 @@ func TestItem_GetURL(t *testing.T) {
 	item := &Item{Content: "test", TTL: 60, Times: 1, Key: key}
 
 	expected := fmt.Sprintf("%v/%v", uri, key)
-	if u := item.GetURL(r, false); u.String() != expected {
+	if u := item.GetURL(r, false, "/"); u.String() != expected {
 		t.Error("failed non-secure check", u.String())
 	}
 
 	uri = "https://example.com"
 	expected = fmt.Sprintf("%v/%v", uri, key)
-	if u := item.GetURL(r, true); u.String() != expected {
+	if u := item.GetURL(r, true, "/"); u.String() != expected {
 		t.Error("failed secure check", u.String())
 	}
+
+	expected = fmt.Sprintf("%v/enigma/%v", uri, key)
+	if u := item.GetURL(r, true, "/enigma/"); u.String() != expected {
+		t.Error("failed base path check", u.String())
+	}
+	item.Key = CodePrefix + "lamp-river-rope-7"
+	expected = fmt.Sprintf("%v/enigma/code", uri)
+	if u := item.GetURL(r, true, "/enigma/"); u.String() != expected {
+		t.Error("failed code check", u.String())
+	}
 }
 
 func TestItem_Save(t *testing.T) {
@@ -210,6 +230,79 @@ func TestItem_Save(t *testing.T) {
 	}
 }
 
+type testReserver struct {
+	accept   bool
+	keys     []string
+	sizes    []int
+	released int
+}
+
+func (r *testReserver) Reserve(item *Item, size int) (bool, error) {
+	r.keys, r.sizes = append(r.keys, item.Key), append(r.sizes, size)
+	return r.accept, nil
+}
+
+func (r *testReserver) Release(item *Item) {
+	r.released++
+}
+
+func TestItem_SaveReserved(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	defer func() {
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	content := strings.Repeat("test", 64)
+	rejecter := &testReserver{}
+	item := &Item{Content: content, TTL: 60, Times: 1}
+	ok, err := item.SaveReserved(conn, cipherKey, rejecter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || (item.Key != "") {
+		t.Errorf("rejected item was saved: %q", item.Key)
+	}
+	if (len(rejecter.sizes) != 1) || (rejecter.released != 0) {
+		t.Errorf("unexpected reservations: %v, released %d", rejecter.sizes, rejecter.released)
+	}
+	reserver := &testReserver{accept: true}
+	item = &Item{Content: content, TTL: 60, Times: 1}
+	ok, err = item.SaveReserved(conn, cipherKey, reserver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("item was not saved")
+	}
+	if (len(reserver.sizes) != 1) || (reserver.released != 0) {
+		t.Errorf("unexpected reservations: %v, released %d", reserver.sizes, reserver.released)
+	}
+	stored, err := redis.Int(conn.Do("HSTRLEN", item.Key, fieldContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := reserver.sizes[0]; (size != stored) || (size == len(content)) {
+		t.Errorf("reserved size %d, stored %d, plain %d", size, stored, len(content))
+	}
+	ok, err = item.delete(conn)
+	if err != nil {
+		t.Errorf("failed delete item: %v", err)
+	}
+	if !ok {
+		t.Error("item was not deleted")
+	}
+}
+
 func TestItem_Exists(t *testing.T) {
 	pool, err := readCfg()
 	if err != nil {
@@ -332,12 +425,18 @@ func TestItem_Read(t *testing.T) {
 	}
 	key := item.Key
 	// read with failed key
-	item.Key = "abc"
+	item.Key, item.hPassword = "abc", ""
 	exists, err := item.Read(conn, cipherKey)
-	if exists {
-		t.Error("unexpected success read")
+	if exists || (err != nil) {
+		t.Errorf("unexpected success read: %v", err)
 	}
-	item.Key = key
+	// read with failed password doesn't change readings counter
+	item.Key, item.Password, item.hPassword = key, "bad", ""
+	exists, err = item.Read(conn, cipherKey)
+	if exists || (err != ErrPassword) {
+		t.Errorf("unexpected read with failed password: %v", err)
+	}
+	item.Password, item.hPassword = "", ""
 	// success read
 	exists, err = item.Read(conn, cipherKey)
 	if !exists || (err != nil) {
@@ -372,8 +471,9 @@ func TestItem_Read(t *testing.T) {
 
 func TestItem_ReadConcurrent(t *testing.T) {
 	const (
-		times   = 128
-		workers = 8
+		times    = 256
+		workers  = 32
+		password = "abc"
 	)
 	pool, err := readCfg()
 	if err != nil {
@@ -390,26 +490,38 @@ func TestItem_ReadConcurrent(t *testing.T) {
 			t.Errorf("close pool errror: %v", err)
 		}
 	}()
-	item := &Item{Content: "test", TTL: 60, Times: times}
+	item := &Item{Content: "test", TTL: 60, Times: times, Password: password}
 	err = item.Save(conn, cipherKey)
 	if err != nil {
 		t.Fatal(err)
 	}
 	key, content := item.Key, item.Content
+	// remaining readings of successful attempts, -1 for failed ones
 	ch := make(chan int)
 	for i := 0; i < workers; i++ {
 		go func(n int) {
-			x := &Item{Key: key, Content: content}
+			x := &Item{Key: key, Password: password}
+			if n%4 == 0 {
+				// every 4th worker has a wrong password
+				x.Password = "bad"
+			}
 			for j := 0; j < times; j++ {
 				c := pool.Get()
+				x.Content, x.hPassword = "", ""
 				exists, err := x.Read(c, cipherKey)
-				if err != nil {
+				if (err != nil) && (err != ErrPassword) {
 					t.Errorf("unexpected error read, worker=%v: %v", n, err)
 				}
 				if exists {
-					ch <- 1
+					if x.Password != password {
+						t.Errorf("successful read with wrong password, worker=%v", n)
+					}
+					if x.Content != content {
+						t.Errorf("failed content, worker=%v: %v", n, x.Content)
+					}
+					ch <- x.Times
 				} else {
-					ch <- 0
+					ch <- -1
 				}
 				err = c.Close()
 				if err != nil {
@@ -419,13 +531,35 @@ func TestItem_ReadConcurrent(t *testing.T) {
 		}(i)
 	}
 	s := 0
+	remaining := make(map[int]bool, times)
 	for i := 0; i < workers*times; i++ {
-		s += <-ch
+		n := <-ch
+		if n < 0 {
+			continue
+		}
+		s++
+		if remaining[n] {
+			t.Errorf("repeated remaining readings value: %v", n)
+		}
+		remaining[n] = true
 	}
 	close(ch)
 	if s != times {
 		t.Errorf("failed sum=%v", s)
 	}
+	for i := 0; i < times; i++ {
+		if !remaining[i] {
+			t.Errorf("absent remaining readings value: %v", i)
+		}
+	}
+	// no orphan hash after the last reading
+	n, err := redis.Int(conn.Do("EXISTS", key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("item key still exists")
+	}
 }
 
 func BenchmarkItem_Save(b *testing.B) {
@@ -461,6 +595,150 @@ func BenchmarkItem_Save(b *testing.B) {
 	}
 }
 
+// saveMulti saves the item like before using a key existence check and MULTI transaction,
+// it is used only to compare performance with one script call.
+func saveMulti(item *Item, c redis.Conn, skey []byte) error {
+	var (
+		key    string
+		err    error
+		exists = true
+	)
+	for i := 0; exists && (i < maxCollisions); i++ {
+		key, err = item.Format.NewKey()
+		if err != nil {
+			return err
+		}
+		exists, err = redis.Bool(c.Do("HEXISTS", key, fieldContent))
+		if err != nil {
+			return err
+		}
+	}
+	item.Key = key
+	err = item.hashPassword()
+	if err != nil {
+		return err
+	}
+	err = item.encrypt(skey)
+	if err != nil {
+		return err
+	}
+	err = c.Send("MULTI")
+	if err != nil {
+		return err
+	}
+	err = c.Send("HSET", item.Key, fieldContent, item.eContent)
+	if err != nil {
+		return err
+	}
+	err = c.Send("HSET", item.Key, fieldPassword, item.hPassword)
+	if err != nil {
+		return err
+	}
+	err = c.Send("HSET", item.Key, fieldTimes, item.Times)
+	if err != nil {
+		return err
+	}
+	err = c.Send("EXPIRE", item.Key, item.TTL)
+	if err != nil {
+		return err
+	}
+	result, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+	if len(result) != 4 {
+		return errors.New("unexpected multi item result")
+	}
+	return nil
+}
+
+func TestItem_SaveCollision(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	defer func() {
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	item := &Item{Content: "test", TTL: 60, Times: 3}
+	err = item.Save(conn, cipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ok, err := item.delete(conn)
+		if err != nil {
+			t.Errorf("failed delete item: %v", err)
+		}
+		if !ok {
+			t.Error("item was not deleted")
+		}
+	}()
+	// existing item can't be overwritten
+	ok, err := redis.Bool(saveScript.Do(conn, item.Key, "other", "other", 1, 10, "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("existing item was overwritten")
+	}
+	values, err := redis.StringMap(conn.Do("HGETALL", item.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (values[fieldContent] != item.eContent) || (values[fieldTimes] != "3") {
+		t.Errorf("item was changed: %v", values)
+	}
+	ttl, err := redis.Int(conn.Do("TTL", item.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (ttl < 1) || (ttl > 60) {
+		t.Errorf("failed ttl: %v", ttl)
+	}
+}
+
+func BenchmarkItem_SaveMulti(b *testing.B) {
+	pool, err := readCfg()
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn := pool.Get()
+	defer func() {
+		err = conn.Close()
+		if err != nil {
+			b.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			b.Errorf("close pool errror: %v", err)
+		}
+	}()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		item := Item{Content: "test", TTL: 10, Times: 1}
+		err = saveMulti(&item, conn, cipherKey)
+		if err != nil {
+			b.Errorf("failed save: %v", err)
+		}
+		ok, err := item.delete(conn)
+		if err != nil {
+			b.Errorf("failed delete: %v", err)
+		}
+		if !ok {
+			b.Error("item was not deleted")
+		}
+	}
+}
+
 func BenchmarkItem_Read(b *testing.B) {
 	pool, err := readCfg()
 	if err != nil {
@@ -500,3 +778,44 @@ func BenchmarkItem_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestItem_Expiration(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	defer func() {
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	item := &Item{Content: "test", TTL: 60, Times: 1}
+	err = item.Save(conn, cipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiration, err := item.Expiration(conn, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiration); (d <= 0) || (d > time.Minute) {
+		t.Errorf("failed expiration: %v", d)
+	}
+	ok, err := item.delete(conn)
+	if err != nil {
+		t.Errorf("failed delete item: %v", err)
+	}
+	if !ok {
+		t.Error("item was not deleted")
+	}
+	_, err = item.Expiration(conn, time.Now())
+	if err == nil {
+		t.Error("expected error for deleted item")
+	}
+}
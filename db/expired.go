@@ -0,0 +1,39 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// IsItemKey returns true if the key is item's one, not a related nonce, request or counter.
+func IsItemKey(key string) bool {
+	return (key != "") && !strings.ContainsAny(key, "{}") &&
+		!strings.HasPrefix(key, requestPrefix) && !strings.HasPrefix(key, limitPrefix)
+}
+
+// WatchExpired calls fn for every expired item using keyspace notifications
+// of database number db, so the server should have "Ex" flags in "notify-keyspace-events".
+// It blocks until the connection is closed or failed.
+func WatchExpired(c redis.Conn, db int, fn func(key string)) error {
+	psc := redis.PubSubConn{Conn: c}
+	err := psc.Subscribe(fmt.Sprintf("__keyevent@%d__:expired", db))
+	if err != nil {
+		return err
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			if key := string(v.Data); IsItemKey(key) {
+				fn(key)
+			}
+		case error:
+			return v
+		}
+	}
+}
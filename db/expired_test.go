@@ -0,0 +1,69 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestIsItemKey(t *testing.T) {
+	cases := map[string]bool{
+		"":                         false,
+		"abc":                      true,
+		CodePrefix + "lamp-rope-7": true,
+		"{abc}:nonce:123":          false,
+		requestPrefix + "abc":      false,
+		limitPrefix + "code":       false,
+	}
+	for key, expected := range cases {
+		if IsItemKey(key) != expected {
+			t.Errorf("failed key %q", key)
+		}
+	}
+}
+
+func TestWatchExpired(t *testing.T) {
+	addr := startRedis(t, tempDir(t), "--notify-keyspace-events", "Ex")
+	conn, err := redis.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(chan string, 4)
+	done := make(chan error)
+	go func() {
+		done <- WatchExpired(conn, 0, func(key string) {
+			keys <- key
+		})
+	}()
+	other, err := redis.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	waitFor(t, "subscription", func() bool {
+		n, err := redis.Values(other.Do("PUBSUB", "NUMSUB", "__keyevent@0__:expired"))
+		return (err == nil) && (len(n) == 2) && (n[1].(int64) == 1)
+	})
+	for _, key := range []string{"{item}:nonce:abc", "item"} {
+		_, err = other.Do("SET", key, 1, "PX", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case key := <-keys:
+		if key != "item" {
+			t.Errorf("failed expired key: %v", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expired key is not received")
+	}
+	err = conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err == nil {
+		t.Error("expected error after connection close")
+	}
+}
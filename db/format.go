@@ -0,0 +1,81 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Stored content is raw bytes: a format version, flags, AES IV and encrypted data.
+// Legacy items have hex encoded IV and data, they are still readable,
+// because a hex string never starts with formatVersion byte.
+const (
+	// formatVersion is the first byte of stored content.
+	formatVersion byte = 1
+	// flagCompressed marks content compressed by DEFLATE before encryption.
+	flagCompressed byte = 1
+	// headerLen is a length of stored content header: version and flags.
+	headerLen = 2
+	// minCompressLen is a minimal content length for compression,
+	// shorter content is rarely reduced.
+	minCompressLen = 128
+)
+
+// compress returns DEFLATE compressed data and true if it's shorter than the original one.
+func compress(data []byte) ([]byte, bool) {
+	if len(data) < minCompressLen {
+		return nil, false
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, false
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, false
+	}
+	err = w.Close()
+	if (err != nil) || (buf.Len() >= len(data)) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decompress returns DEFLATE decompressed data.
+func decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	result, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Close()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// unpack returns encrypted data and flags of stored content.
+func unpack(stored string) ([]byte, byte, error) {
+	if (stored == "") || (stored[0] != formatVersion) {
+		// legacy hex format without compression
+		data, err := hex.DecodeString(stored)
+		return data, 0, err
+	}
+	if len(stored) < headerLen {
+		return nil, 0, errors.New("invalid content header")
+	}
+	flags := stored[1]
+	if flags&^flagCompressed != 0 {
+		return nil, 0, fmt.Errorf("unknown content flags %#x", flags)
+	}
+	return []byte(stored[headerLen:]), flags, nil
+}
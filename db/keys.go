@@ -0,0 +1,176 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const (
+	// EncodingHex is lowercase hexadecimal keys encoding, it's default one.
+	EncodingHex = "hex"
+	// EncodingBase62 is keys encoding with digits and latin letters in both cases.
+	EncodingBase62 = "base62"
+	// EncodingBase32 is Crockford's base32 keys encoding, it's case insensitive.
+	EncodingBase32 = "base32"
+	// EncodingWords is keys encoding by English words for dictation, one word for every byte.
+	EncodingWords = "words"
+
+	// MinKeyLen is a minimal number of random bytes for item's key.
+	MinKeyLen = 8
+
+	base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	wordsSeparator    = "-"
+)
+
+var (
+	crockford = base32.NewEncoding(crockfordAlphabet).WithPadding(base32.NoPadding)
+	// crockfordReplacer maps ambiguous symbols to Crockford's base32 alphabet ones.
+	crockfordReplacer = strings.NewReplacer("I", "1", "L", "1", "O", "0", "-", "")
+	// wordIndex is a set of dictation words.
+	wordIndex = make(map[string]bool, len(words))
+)
+
+func init() {
+	for _, w := range words {
+		wordIndex[w] = true
+	}
+}
+
+// KeyFormat is item's key generation settings.
+type KeyFormat struct {
+	Len      int    `json:"key_len"`
+	Encoding string `json:"key_encoding"`
+}
+
+// Validate checks the settings and sets default values for empty ones.
+func (f *KeyFormat) Validate() error {
+	if f.Len == 0 {
+		f.Len = KeyLen
+	}
+	if f.Encoding == "" {
+		f.Encoding = EncodingHex
+	}
+	if (f.Len < MinKeyLen) || (f.Len > KeyLen) {
+		return fmt.Errorf("key length should be in a range [%v; %v] bytes", MinKeyLen, KeyLen)
+	}
+	switch f.Encoding {
+	case EncodingHex, EncodingBase62, EncodingBase32, EncodingWords:
+		return nil
+	}
+	return fmt.Errorf("unknown key encoding %v", f.Encoding)
+}
+
+// settings returns key length and encoding, nil format means default settings.
+func (f *KeyFormat) settings() (int, string) {
+	if f == nil {
+		return KeyLen, EncodingHex
+	}
+	return f.Len, f.Encoding
+}
+
+// String returns key format description.
+func (f *KeyFormat) String() string {
+	n, encoding := f.settings()
+	return fmt.Sprintf("%v bytes %v", n, encoding)
+}
+
+// NewKey returns new random key. Nil format means default settings.
+func (f *KeyFormat) NewKey() (string, error) {
+	n, encoding := f.settings()
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	switch encoding {
+	case EncodingHex:
+		return hex.EncodeToString(b), nil
+	case EncodingBase62:
+		return encodeBase62(b), nil
+	case EncodingBase32:
+		return crockford.EncodeToString(b), nil
+	case EncodingWords:
+		parts := make([]string, n)
+		for i, c := range b {
+			parts[i] = words[c]
+		}
+		return strings.Join(parts, wordsSeparator), nil
+	}
+	return "", fmt.Errorf("unknown key encoding %v", encoding)
+}
+
+// base62Len returns a length of base62 string for n bytes.
+func base62Len(n int) int {
+	return int(math.Ceil(float64(n*8) / math.Log2(62)))
+}
+
+// encodeBase62 returns fixed length base62 representation of bytes.
+func encodeBase62(b []byte) string {
+	n := base62Len(len(b))
+	result := make([]byte, n)
+	x, base, mod := new(big.Int).SetBytes(b), big.NewInt(62), new(big.Int)
+	for i := n - 1; i >= 0; i-- {
+		x.DivMod(x, base, mod)
+		result[i] = base62Alphabet[mod.Int64()]
+	}
+	return string(result)
+}
+
+// inAlphabet returns true if all symbols of s are from the alphabet.
+func inAlphabet(s, alphabet string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeyCandidates returns possible item's keys for a key from URL.
+// Keys of all supported encodings and lengths are accepted,
+// so old links stay valid after settings change. Empty result means invalid key.
+func KeyCandidates(raw string) []string {
+	var keys []string
+	add := func(key string) {
+		for _, k := range keys {
+			if k == key {
+				return
+			}
+		}
+		keys = append(keys, key)
+	}
+	// words keys are not ambiguous, hyphens are not expected in other encodings
+	parts := strings.Split(strings.ToLower(raw), wordsSeparator)
+	if (len(parts) >= MinKeyLen) && (len(parts) <= KeyLen) {
+		valid := true
+		for _, p := range parts {
+			valid = valid && wordIndex[p]
+		}
+		if valid {
+			return []string{strings.Join(parts, wordsSeparator)}
+		}
+	}
+	n := len(raw)
+	if (n%2 == 0) && (n >= MinKeyLen*2) && (n <= KeyLen*2) && inAlphabet(raw, "0123456789abcdef") {
+		add(raw)
+	}
+	if (n >= base62Len(MinKeyLen)) && (n <= base62Len(KeyLen)) && inAlphabet(raw, base62Alphabet) {
+		add(raw)
+	}
+	key := crockfordReplacer.Replace(strings.ToUpper(raw))
+	n = len(key)
+	if (n >= crockford.EncodedLen(MinKeyLen)) && (n <= crockford.EncodedLen(KeyLen)) && inAlphabet(key, crockfordAlphabet) {
+		add(key)
+	}
+	return keys
+}
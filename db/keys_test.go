@@ -0,0 +1,105 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestKeyFormat_Validate(t *testing.T) {
+	cases := []struct {
+		f   KeyFormat
+		err bool
+	}{
+		{f: KeyFormat{}},
+		{f: KeyFormat{Len: MinKeyLen, Encoding: EncodingWords}},
+		{f: KeyFormat{Len: 16, Encoding: EncodingBase62}},
+		{f: KeyFormat{Len: KeyLen, Encoding: EncodingBase32}},
+		{f: KeyFormat{Len: MinKeyLen - 1}, err: true},
+		{f: KeyFormat{Len: KeyLen + 1}, err: true},
+		{f: KeyFormat{Encoding: "base64"}, err: true},
+	}
+	for i, c := range cases {
+		err := c.f.Validate()
+		if (err != nil) != c.err {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+	}
+	f := &KeyFormat{}
+	if err := f.Validate(); err != nil || (f.Len != KeyLen) || (f.Encoding != EncodingHex) {
+		t.Errorf("failed defaults: %v, %v", f, err)
+	}
+}
+
+func TestKeyFormat_NewKey(t *testing.T) {
+	cases := []struct {
+		f    *KeyFormat
+		size int
+	}{
+		{f: nil, size: KeyLen * 2},
+		{f: &KeyFormat{Len: 16, Encoding: EncodingHex}, size: 32},
+		{f: &KeyFormat{Len: 16, Encoding: EncodingBase62}, size: 22},
+		{f: &KeyFormat{Len: 10, Encoding: EncodingBase32}, size: 16},
+		{f: &KeyFormat{Len: 8, Encoding: EncodingWords}, size: -1},
+	}
+	for i, c := range cases {
+		keys := make(map[string]bool)
+		for j := 0; j < 64; j++ {
+			key, err := c.f.NewKey()
+			if err != nil {
+				t.Fatalf("failed case=%v: %v", i, err)
+			}
+			if (c.size > 0) && (len(key) != c.size) {
+				t.Errorf("failed case=%v size: %v", i, key)
+			}
+			if strings.ContainsAny(key, "{}:") {
+				t.Errorf("failed case=%v symbols: %v", i, key)
+			}
+			candidates := KeyCandidates(key)
+			if (len(candidates) == 0) || (candidates[0] != key) {
+				t.Errorf("failed case=%v candidates: %v => %v", i, key, candidates)
+			}
+			keys[key] = true
+		}
+		if len(keys) != 64 {
+			t.Errorf("failed case=%v: duplicate keys", i)
+		}
+	}
+}
+
+func TestKeyFormat_String(t *testing.T) {
+	var f *KeyFormat
+	if s := f.String(); s != fmt.Sprintf("%v bytes hex", KeyLen) {
+		t.Errorf("failed default format: %v", s)
+	}
+	f = &KeyFormat{Len: 10, Encoding: EncodingBase32}
+	if s := f.String(); s != "10 bytes base32" {
+		t.Errorf("failed format: %v", s)
+	}
+}
+
+func TestKeyCandidates(t *testing.T) {
+	var words8 = "area-army-baby-ball-band-bank-base-bath"
+	cases := []struct {
+		raw  string
+		keys []string
+	}{
+		{raw: ""},
+		{raw: "abc"},
+		{raw: "key:{x}-name-value"},
+		{raw: strings.Repeat("a", KeyLen*2), keys: []string{strings.Repeat("a", KeyLen*2)}},
+		{raw: strings.Repeat("a", KeyLen*2+2)},
+		{raw: "0123456789abcdef", keys: []string{"0123456789abcdef", "0123456789ABCDEF"}},
+		{raw: "0123456789AbCdEfXyz", keys: []string{"0123456789AbCdEfXyz", "0123456789ABCDEFXYZ"}},
+		{raw: "0oIl-2345-6789-ABCD", keys: []string{"001123456789ABCD"}},
+		{raw: words8, keys: []string{words8}},
+		{raw: strings.ToUpper(words8), keys: []string{words8}},
+		{raw: "area-army-baby-ball-band-bank-base-unknown"},
+	}
+	for i, c := range cases {
+		keys := KeyCandidates(c.raw)
+		if strings.Join(keys, ",") != strings.Join(c.keys, ",") {
+			t.Errorf("failed case=%v: %v", i, keys)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// NonceLen is a number of bytes for reveal confirmation nonce:
+	// expiration time, random identifier and truncated signature.
+	NonceLen = nonceExpLen + nonceIDLen + nonceMACLen
+
+	nonceExpLen = 8
+	nonceIDLen  = 8
+	nonceMACLen = 16
+
+	// nonceSuffix is a key suffix for spent nonces of an item, nonce identifier follows it.
+	nonceSuffix = "nonce:"
+)
+
+// nonceMAC returns the signature of nonce's payload for item with a key.
+func nonceMAC(skey []byte, key string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, skey)
+	mac.Write([]byte(key))
+	mac.Write(payload)
+	return mac.Sum(nil)[:nonceMACLen]
+}
+
+// NewNonce creates one-time reveal confirmation nonce for item with a key.
+// The nonce is valid during ttl seconds since now. It is signed by skey
+// and is not stored, so showing of confirmation form doesn't write to database.
+func NewNonce(skey []byte, key string, now time.Time, ttl int) (string, error) {
+	if key == "" {
+		return "", errors.New("empty key for nonce")
+	}
+	if ttl < 1 {
+		return "", errors.New("invalid nonce ttl")
+	}
+	if len(skey) == 0 {
+		return "", errors.New("empty nonce secret key")
+	}
+	var b [NonceLen]byte
+	binary.BigEndian.PutUint64(b[:nonceExpLen], uint64(now.Unix()+int64(ttl)))
+	payload := b[:nonceExpLen+nonceIDLen]
+	_, err := rand.Read(payload[nonceExpLen:])
+	if err != nil {
+		return "", err
+	}
+	copy(b[len(payload):], nonceMAC(skey, key, payload))
+	return hex.EncodeToString(b[:]), nil
+}
+
+// CheckNonce consumes the nonce and returns true if it was issued for item with a key
+// and is not expired yet. Any nonce can be checked only once, so repeated submits are rejected,
+// used nonce is stored only until its expiration.
+func CheckNonce(c redis.Conn, skey []byte, nonce, key string, now time.Time) (bool, error) {
+	if (len(nonce) != NonceLen*2) || (key == "") || (len(skey) == 0) {
+		return false, nil
+	}
+	b, err := hex.DecodeString(nonce)
+	if err != nil {
+		return false, nil
+	}
+	payload := b[:nonceExpLen+nonceIDLen]
+	if !hmac.Equal(b[len(payload):], nonceMAC(skey, key, payload)) {
+		return false, nil
+	}
+	ttl := int64(binary.BigEndian.Uint64(b[:nonceExpLen])) - now.Unix()
+	if ttl < 1 {
+		return false, nil
+	}
+	id := hex.EncodeToString(payload[nonceExpLen:])
+	// the key name contains item's key, so it is in the same cluster slot
+	_, err = redis.String(c.Do("SET", tagKey(key, nonceSuffix+id), 1, "EX", ttl, "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewNonce(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	defer func() {
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	now := time.Now()
+	if _, err = NewNonce(cipherKey, "", now, 10); err == nil {
+		t.Error("expected error for empty key")
+	}
+	if _, err = NewNonce(cipherKey, "abc", now, 0); err == nil {
+		t.Error("expected error for invalid ttl")
+	}
+	if _, err = NewNonce(nil, "abc", now, 10); err == nil {
+		t.Error("expected error for empty secret key")
+	}
+	nonce, err := NewNonce(cipherKey, "abc", now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(nonce); l != NonceLen*2 {
+		t.Errorf("invalid nonce length: %v", l)
+	}
+	other, err := NewNonce(cipherKey, "abc", now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce == other {
+		t.Error("nonce is not unique")
+	}
+	// signature is checked, so a nonce can't be changed
+	forged := other[:NonceLen*2-1] + "0"
+	if forged == other {
+		forged = other[:NonceLen*2-1] + "1"
+	}
+	cases := []struct {
+		nonce string
+		key   string
+		now   time.Time
+		ok    bool
+	}{
+		{nonce: "", key: "abc", ok: false},
+		{nonce: forged, key: "abc", ok: false},
+		{nonce: other, key: "abc", now: now.Add(11 * time.Second), ok: false},
+		{nonce: strings.Repeat("0", NonceLen*2), key: "abc", ok: false},
+		{nonce: other, key: "bad", ok: false},
+		{nonce: other, key: "abc", ok: true},
+		{nonce: other, key: "abc", ok: false},
+		{nonce: nonce, key: "abc", ok: true},
+		{nonce: nonce, key: "abc", ok: false},
+	}
+	for i, v := range cases {
+		if v.now.IsZero() {
+			v.now = now
+		}
+		ok, err := CheckNonce(conn, cipherKey, v.nonce, v.key, v.now)
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+		}
+		if ok != v.ok {
+			t.Errorf("failed case=%v: %v", i, ok)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+const (
+	// ModeSingle is a mode for one redis server.
+	ModeSingle = "single"
+	// ModeSentinel is a mode for redis master discovered by Sentinel.
+	ModeSentinel = "sentinel"
+	// ModeCluster is a mode for Redis Cluster.
+	ModeCluster = "cluster"
+
+	// errBound is redisc error message for repeated binding.
+	errBound = "redisc: connection already bound to a node"
+	// pingIdle is an idle time of connection after which it is checked before using.
+	pingIdle = time.Minute
+)
+
+// masterIdle is an idle time of Sentinel master connection after which its role is checked,
+// it's shorter than pingIdle, because old master is usually available after failover.
+var masterIdle = 5 * time.Second
+
+// dialOptions returns common connection options.
+func (c *Cfg) dialOptions() []redis.DialOption {
+	options := append(c.tlsOptions(),
+		redis.DialConnectTimeout(c.timeout),
+		redis.DialUsername(c.Username),
+		redis.DialPassword(c.Password),
+	)
+	if c.Mode != ModeCluster {
+		// cluster has only one database
+		options = append(options, redis.DialDatabase(c.Db))
+	}
+	return options
+}
+
+// tlsOptions returns TLS connection options if it's enabled.
+func (c *Cfg) tlsOptions() []redis.DialOption {
+	if c.tlsConfig == nil {
+		return nil
+	}
+	return []redis.DialOption{
+		redis.DialUseTLS(true),
+		redis.DialTLSConfig(c.tlsConfig),
+	}
+}
+
+// newPool returns connections pool with custom dial and check functions.
+func (c *Cfg) newPool(dial func() (redis.Conn, error), test func(redis.Conn, time.Time) error) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:      c.IndleCon,
+		MaxActive:    c.MaxCon,
+		IdleTimeout:  c.timeout,
+		Wait:         true,
+		Dial:         dial,
+		TestOnBorrow: test,
+	}
+}
+
+// testPing checks idle connection using PING command.
+func testPing(c redis.Conn, t time.Time) error {
+	if time.Since(t) < pingIdle {
+		return nil
+	}
+	_, err := c.Do("PING")
+	return err
+}
+
+// testIdleMaster checks idle connection like testMaster,
+// so ROLE command isn't sent every time when recently used connection is borrowed.
+func testIdleMaster(c redis.Conn, t time.Time) error {
+	if time.Since(t) < masterIdle {
+		return nil
+	}
+	return testMaster(c)
+}
+
+// testMaster checks that connection is established with master,
+// so connections to old master are dropped after failover.
+func testMaster(c redis.Conn) error {
+	values, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return errors.New("empty role response")
+	}
+	role, err := redis.String(values[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != "master" {
+		return fmt.Errorf("unexpected redis role %v", role)
+	}
+	return nil
+}
+
+// MasterAddr returns current master address from the first available Sentinel.
+func (c *Cfg) MasterAddr() (string, error) {
+	var lastErr error
+	for _, addr := range c.Addrs {
+		conn, err := redis.Dial("tcp", addr, append(c.tlsOptions(),
+			redis.DialConnectTimeout(c.timeout),
+			redis.DialReadTimeout(c.timeout),
+			redis.DialWriteTimeout(c.timeout),
+			redis.DialPassword(c.SentinelPassword),
+		)...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		values, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", c.Master))
+		closeErr := conn.Close()
+		switch {
+		case err == redis.ErrNil:
+			lastErr = fmt.Errorf("sentinel %v doesn't know master %v", addr, c.Master)
+		case err != nil:
+			lastErr = err
+		case closeErr != nil:
+			lastErr = closeErr
+		case len(values) != 2:
+			lastErr = fmt.Errorf("unexpected sentinel %v response: %v", addr, values)
+		default:
+			return net.JoinHostPort(values[0], values[1]), nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no sentinel addresses")
+	}
+	return "", lastErr
+}
+
+// dialMaster creates new connection to current master.
+func (c *Cfg) dialMaster() (redis.Conn, error) {
+	addr, err := c.MasterAddr()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := redis.Dial("tcp", addr, c.dialOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	err = testMaster(conn)
+	if err != nil {
+		// sentinel is not updated yet during failover
+		if e := conn.Close(); e != nil {
+			return nil, fmt.Errorf("%v, close error: %v", err, e)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// newCluster returns Redis Cluster client with connections pool for every node.
+func (c *Cfg) newCluster() (*redisc.Cluster, error) {
+	cluster := &redisc.Cluster{
+		StartupNodes: c.Addrs,
+		DialOptions:  c.dialOptions(),
+		PoolWaitTime: c.timeout,
+		CreatePool: func(addr string, options ...redis.DialOption) (*redis.Pool, error) {
+			return c.newPool(func() (redis.Conn, error) {
+				return redis.Dial("tcp", addr, options...)
+			}, testPing), nil
+		},
+	}
+	err := cluster.Refresh()
+	if err != nil {
+		if e := cluster.Close(); e != nil {
+			return nil, fmt.Errorf("%v, close error: %v", err, e)
+		}
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// bind binds cluster connection to the node that serves the key.
+// Item's related keys use hash tag "{<key>}", so they are in the same slot.
+// It does nothing for other connections. An already bound connection
+// is accepted only if its node serves the key, otherwise an error is returned.
+func bind(c redis.Conn, key string) error {
+	cc, ok := c.(*redisc.Conn)
+	if !ok {
+		return nil
+	}
+	err := cc.Bind(key)
+	if (err == nil) || (err.Error() != errBound) {
+		return err
+	}
+	// redisc doesn't expose the bound node, so it's checked by a command with the key
+	_, err = cc.Do("EXISTS", key)
+	if redisc.ParseRedir(err) != nil {
+		return fmt.Errorf("connection is bound to other node than key %q: %w", key, err)
+	}
+	return err
+}
+
+// tagKey returns related to item key with suffix,
+// the result has hash tag and it is in the same cluster slot as the item.
+func tagKey(key, suffix string) string {
+	return "{" + key + "}:" + suffix
+}
@@ -0,0 +1,599 @@
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+// freePort returns free local TCP port.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	err = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// startRedis runs local redis-server process with arguments and returns its address.
+// The test is skipped if redis-server is not installed.
+func startRedis(t *testing.T, dir string, args ...string) string {
+	bin, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server is not found")
+	}
+	port := freePort(t)
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	args = append(args, "--port", strconv.Itoa(port), "--dir", dir, "--save", "", "--appendonly", "no")
+	cmd := exec.Command(bin, args...)
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := cmd.Process.Kill(); err != nil {
+			t.Errorf("failed kill redis %v: %v", addr, err)
+		}
+		_ = cmd.Wait()
+	})
+	waitFor(t, fmt.Sprintf("redis %v start", addr), func() bool {
+		conn, err := redis.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		_, err = conn.Do("PING")
+		return err == nil
+	})
+	return addr
+}
+
+// waitFor waits until condition becomes true.
+func waitFor(t *testing.T, name string, condition func() bool) {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("timeout: %v", name)
+}
+
+// tempDir returns temporary directory that is removed after the test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "enigma-redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("failed remove %v: %v", dir, err)
+		}
+	})
+	return dir
+}
+
+// checkPool saves and reads an item using the pool.
+func checkPool(t *testing.T, pool Pool) {
+	const times = 2
+	item := &Item{Content: "test", TTL: 60, Times: times, Password: "abc"}
+	conn := pool.Get()
+	err := item.Save(conn, cipherKey)
+	if e := conn.Close(); e != nil {
+		t.Errorf("close connection error: %v", e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := times - 1; i >= 0; i-- {
+		// new connection for every reading, like for HTTP requests
+		conn = pool.Get()
+		nonce, err := NewNonce(cipherKey, item.Key, time.Now(), 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := CheckNonce(conn, cipherKey, nonce, item.Key, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Error("failed nonce check")
+		}
+		x := &Item{Key: item.Key, Password: item.Password}
+		ok, err = x.CheckPassword(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Error("failed password check")
+		}
+		exists, err := x.Read(conn, cipherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists || (x.Content != item.Content) || (x.Times != i) {
+			t.Errorf("failed read: %v, %v", exists, x.Times)
+		}
+		if e := conn.Close(); e != nil {
+			t.Errorf("close connection error: %v", e)
+		}
+	}
+}
+
+func TestGetDbPool_Modes(t *testing.T) {
+	cases := []*Cfg{
+		{Mode: "unknown", Timeout: 1, IndleCon: 1, MaxCon: 1},
+		{Mode: ModeSentinel, Timeout: 1, IndleCon: 1, MaxCon: 1, Master: "mymaster"},
+		{Mode: ModeSentinel, Timeout: 1, IndleCon: 1, MaxCon: 1, Addrs: []string{"127.0.0.1:1"}},
+		{Mode: ModeCluster, Timeout: 1, IndleCon: 1, MaxCon: 1},
+		{Mode: ModeCluster, Timeout: 1, IndleCon: 1, MaxCon: 1, Addrs: []string{"127.0.0.1:1"}, Db: 1},
+	}
+	for i, c := range cases {
+		if _, err := GetDbPool(c); err == nil {
+			t.Errorf("expected error case=%v", i)
+		}
+	}
+}
+
+func TestTagKey(t *testing.T) {
+	key, err := (*KeyFormat)(nil).NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged := tagKey(key, nonceSuffix+"abc")
+	if !strings.HasPrefix(tagged, "{"+key+"}") {
+		t.Errorf("failed tagged key: %v", tagged)
+	}
+	if a, b := redisc.Slot(key), redisc.Slot(tagged); a != b {
+		t.Errorf("different slots: %v != %v", a, b)
+	}
+}
+
+func TestGetDbPool_Sentinel(t *testing.T) {
+	const master = "mymaster"
+	dir := tempDir(t)
+	masterAddr := startRedis(t, dir)
+	host, port, err := net.SplitHostPort(masterAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startRedis(t, tempDir(t), "--replicaof", host, port)
+
+	sentinelCfg := filepath.Join(dir, "sentinel.conf")
+	err = ioutil.WriteFile(sentinelCfg, []byte(fmt.Sprintf(
+		"sentinel monitor %v %v %v 1\n"+
+			"sentinel down-after-milliseconds %v 1000\n"+
+			"sentinel failover-timeout %v 3000\n",
+		master, host, port, master, master,
+	)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentinelAddr := startRedis(t, dir, sentinelCfg, "--sentinel")
+
+	c := &Cfg{
+		Mode:     ModeSentinel,
+		Addrs:    []string{"127.0.0.1:1", sentinelAddr}, // the first sentinel is unavailable
+		Master:   master,
+		Timeout:  1,
+		IndleCon: 1,
+		MaxCon:   4,
+	}
+	pool, err := GetDbPool(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pool.Close(); err != nil {
+			t.Errorf("close pool error: %v", err)
+		}
+	}()
+	addr, err := c.MasterAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != masterAddr {
+		t.Errorf("failed master address: %v", addr)
+	}
+	checkPool(t, pool)
+
+	// failover switches the master, the pool should use new one
+	waitFor(t, "replica discovery", func() bool {
+		conn, err := redis.Dial("tcp", sentinelAddr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		replicas, err := redis.Values(conn.Do("SENTINEL", "replicas", master))
+		return (err == nil) && (len(replicas) > 0)
+	})
+	conn, err := redis.Dial("tcp", sentinelAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Do("SENTINEL", "failover", master)
+	if e := conn.Close(); e != nil {
+		t.Errorf("close sentinel connection error: %v", e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "failover", func() bool {
+		addr, err := c.MasterAddr()
+		return (err == nil) && (addr != masterAddr)
+	})
+	waitFor(t, "new master", func() bool {
+		conn := pool.Get()
+		defer conn.Close()
+		_, err := conn.Do("SET", "enigma-failover-test", 1, "EX", 10)
+		return err == nil
+	})
+	checkPool(t, pool)
+}
+
+func TestGetDbPool_Cluster(t *testing.T) {
+	const nodes = 3
+	addrs := make([]string, nodes)
+	for i := range addrs {
+		addrs[i] = startRedis(t, tempDir(t), "--cluster-enabled", "yes",
+			"--cluster-config-file", "nodes.conf", "--cluster-node-timeout", "1000")
+	}
+	// split slots between nodes and join them
+	for i, addr := range addrs {
+		conn, err := redis.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := redis.Args{"ADDSLOTS"}
+		for slot := i * redisc.HashSlots / nodes; slot < (i+1)*redisc.HashSlots/nodes; slot++ {
+			args = args.Add(slot)
+		}
+		_, err = conn.Do("CLUSTER", args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			host, port, err := net.SplitHostPort(addrs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = conn.Do("CLUSTER", "MEET", host, port)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := conn.Close(); err != nil {
+			t.Errorf("close connection error: %v", err)
+		}
+	}
+	for _, addr := range addrs {
+		waitFor(t, "cluster state "+addr, func() bool {
+			conn, err := redis.Dial("tcp", addr)
+			if err != nil {
+				return false
+			}
+			defer conn.Close()
+			info, err := redis.String(conn.Do("CLUSTER", "INFO"))
+			return (err == nil) && strings.Contains(info, "cluster_state:ok")
+		})
+	}
+	c := &Cfg{Mode: ModeCluster, Addrs: addrs[:1], Timeout: 1, IndleCon: 1, MaxCon: 4}
+	pool, err := GetDbPool(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pool.Close(); err != nil {
+			t.Errorf("close pool error: %v", err)
+		}
+	}()
+	// items are in different slots, so several nodes are used
+	for i := 0; i < 8; i++ {
+		checkPool(t, pool)
+	}
+}
+
+// fakeRedis is a minimal RESP server for tests without redis-server,
+// its handler returns a reply of a command with arguments.
+type fakeRedis struct {
+	addr     string
+	mu       sync.Mutex
+	handler  func(args []string) interface{}
+	commands map[string]int
+}
+
+// newFakeRedis starts new fake server, it is stopped after the test.
+func newFakeRedis(t *testing.T, handler func(args []string) interface{}) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{addr: l.Addr().String(), handler: handler, commands: make(map[string]int)}
+	t.Cleanup(func() {
+		if err := l.Close(); err != nil {
+			t.Errorf("close listener error: %v", err)
+		}
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// setHandler replaces commands handler.
+func (f *fakeRedis) setHandler(handler func(args []string) interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handler = handler
+}
+
+// count returns a number of received commands with a name.
+func (f *fakeRedis) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commands[name]
+}
+
+// serve handles commands of one connection.
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands[strings.ToUpper(args[0])]++
+		handler := f.handler
+		f.mu.Unlock()
+		if _, err = conn.Write(appendReply(nil, handler(args))); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	readInt := func(prefix byte) (int, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		if (len(line) < 3) || (line[0] != prefix) {
+			return 0, fmt.Errorf("unexpected line %q", line)
+		}
+		return strconv.Atoi(strings.TrimSpace(line[1:]))
+	}
+	n, err := readInt('*')
+	if (err != nil) || (n < 1) {
+		return nil, fmt.Errorf("invalid command: %v", err)
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readInt('$')
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+// appendReply appends RESP encoded value to b.
+func appendReply(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "$-1\r\n"...)
+	case error:
+		return append(b, "-"+v.Error()+"\r\n"...)
+	case int:
+		return append(b, fmt.Sprintf(":%d\r\n", v)...)
+	case string:
+		return append(b, fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)...)
+	case []interface{}:
+		b = append(b, fmt.Sprintf("*%d\r\n", len(v))...)
+		for _, x := range v {
+			b = appendReply(b, x)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("unsupported reply type %T", value))
+}
+
+// fakeNode returns commands handler of fake redis server with a role.
+func fakeNode(role string) func(args []string) interface{} {
+	return func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "ROLE":
+			return []interface{}{role, 0, []interface{}{}}
+		case "PING":
+			return "PONG"
+		}
+		return "OK"
+	}
+}
+
+func TestGetDbPool_FakeSentinel(t *testing.T) {
+	masters := []*fakeRedis{newFakeRedis(t, fakeNode("master")), newFakeRedis(t, fakeNode("master"))}
+	var (
+		mu      sync.Mutex
+		current = masters[0].addr
+	)
+	sentinel := newFakeRedis(t, func(args []string) interface{} {
+		if (len(args) != 3) || !strings.EqualFold(args[0], "SENTINEL") || (args[2] != "mymaster") {
+			return fmt.Errorf("ERR unexpected command %v", args)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		host, port, err := net.SplitHostPort(current)
+		if err != nil {
+			return err
+		}
+		return []interface{}{host, port}
+	})
+	c := &Cfg{Mode: ModeSentinel, Addrs: []string{sentinel.addr}, Master: "mymaster", Timeout: 1, IndleCon: 1, MaxCon: 2}
+	pool, err := GetDbPool(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pool.Close(); err != nil {
+			t.Errorf("close pool error: %v", err)
+		}
+	}()
+	ping := func() {
+		conn := pool.Get()
+		if _, err := conn.Do("PING"); err != nil {
+			t.Errorf("failed ping: %v", err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Errorf("close connection error: %v", err)
+		}
+	}
+	// recently used connection is not checked
+	for i := 0; i < 3; i++ {
+		ping()
+	}
+	if n := masters[0].count("ROLE"); n != 1 {
+		t.Errorf("failed number of role checks: %v", n)
+	}
+	// after failover idle connection to old master is dropped
+	masterIdle = 0
+	defer func() {
+		masterIdle = 5 * time.Second
+	}()
+	masters[0].setHandler(fakeNode("slave"))
+	mu.Lock()
+	current = masters[1].addr
+	mu.Unlock()
+	ping()
+	if n := masters[0].count("ROLE"); n != 2 {
+		t.Errorf("old master role is not checked: %v", n)
+	}
+	if (masters[1].count("ROLE") != 1) || (masters[1].count("PING") != 1) {
+		t.Errorf("new master is not used: role %v, ping %v", masters[1].count("ROLE"), masters[1].count("PING"))
+	}
+	// replica is not accepted as master
+	mu.Lock()
+	current = masters[0].addr
+	mu.Unlock()
+	if _, err = c.dialMaster(); err == nil {
+		t.Error("expected error for replica")
+	}
+}
+
+func TestGetDbPool_FakeCluster(t *testing.T) {
+	var (
+		slots []interface{}
+		nodes []*fakeRedis
+	)
+	const n = 2
+	handler := func(i int) func(args []string) interface{} {
+		return func(args []string) interface{} {
+			switch strings.ToUpper(args[0]) {
+			case "CLUSTER":
+				return slots
+			case "PING":
+				return "PONG"
+			case "EXISTS":
+				if slot := redisc.Slot(args[1]); slot*n/redisc.HashSlots != i {
+					return fmt.Errorf("MOVED %d %v", slot, nodes[slot*n/redisc.HashSlots].addr)
+				}
+				return 1
+			}
+			return "OK"
+		}
+	}
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, newFakeRedis(t, handler(i)))
+	}
+	for i, node := range nodes {
+		host, port, err := net.SplitHostPort(node.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		half := redisc.HashSlots / len(nodes)
+		slots = append(slots, []interface{}{i * half, (i+1)*half - 1, []interface{}{host, n}})
+	}
+	c := &Cfg{Mode: ModeCluster, Addrs: []string{nodes[0].addr}, Timeout: 1, IndleCon: 1, MaxCon: 2}
+	pool, err := GetDbPool(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pool.Close(); err != nil {
+			t.Errorf("close pool error: %v", err)
+		}
+	}()
+	// keys with the same hash tag are sent to the node of their slot
+	for _, key := range []string{"a", "b", "c", "d"} {
+		node := nodes[redisc.Slot(key)*len(nodes)/redisc.HashSlots]
+		before := node.count("SET")
+		conn := pool.Get()
+		if err := bind(conn, key); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Do("SET", tagKey(key, "test"), 1); err != nil {
+			t.Errorf("failed set: %v", err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Errorf("close connection error: %v", err)
+		}
+		if node.count("SET") != before+1 {
+			t.Errorf("key %v is not sent to its node", key)
+		}
+	}
+	// repeated binding is allowed only to the same node
+	conn := pool.Get()
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Errorf("close connection error: %v", err)
+		}
+	}()
+	if err := bind(conn, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bind(conn, "a"); err != nil {
+		t.Errorf("failed repeated binding: %v", err)
+	}
+	other := "b"
+	if redisc.Slot(other)*n/redisc.HashSlots == redisc.Slot("a")*n/redisc.HashSlots {
+		other = "c"
+	}
+	if err := bind(conn, other); err == nil {
+		t.Error("expected error of binding to other node")
+	}
+}
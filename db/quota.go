@@ -0,0 +1,122 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// quotaPrefix is a prefix of quotas keys.
+	quotaPrefix = "quota:"
+	// ownersSeparator separates item's quotas owners.
+	ownersSeparator = "\n"
+)
+
+var (
+	// quotaScript removes expired items of the owner's quota from ZSET KEYS[1] and HASH of sizes KEYS[2],
+	// then adds new item if the quota allows it. ARGV are current time in milliseconds,
+	// limits of items number and total size (0 is unlimited), item's key, its size and expiration time in milliseconds.
+	// It returns 1 if the item is added and 0 if the quota is exceeded.
+	quotaScript = redis.NewScript(2, `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if #expired > 0 then
+	redis.call('ZREM', KEYS[1], unpack(expired))
+	redis.call('HDEL', KEYS[2], unpack(expired))
+end
+local total = tonumber(ARGV[5])
+for _, size in ipairs(redis.call('HVALS', KEYS[2])) do
+	total = total + tonumber(size)
+end
+local count, bytes = tonumber(ARGV[2]), tonumber(ARGV[3])
+if (count > 0 and redis.call('ZCARD', KEYS[1]) >= count) or (bytes > 0 and total > bytes) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[6], ARGV[4])
+redis.call('HSET', KEYS[2], ARGV[4], ARGV[5])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+redis.call('PEXPIREAT', KEYS[1], last[2])
+redis.call('PEXPIREAT', KEYS[2], last[2])
+return 1
+`)
+	// releaseScript removes item ARGV[1] from owner's quota keys.
+	releaseScript = redis.NewScript(2, `
+redis.call('ZREM', KEYS[1], ARGV[1])
+return redis.call('HDEL', KEYS[2], ARGV[1])
+`)
+)
+
+// Quota is limits of live items number and their total content size for one owner,
+// an owner is a creator or a client IP address. Zero values disable limits.
+type Quota struct {
+	Count int `json:"quota_count"`
+	Bytes int `json:"quota_bytes"`
+}
+
+// Enabled returns true if the quota has limits.
+func (q *Quota) Enabled() bool {
+	return (q.Count > 0) || (q.Bytes > 0)
+}
+
+// splitOwners returns quotas owners stored as one string.
+func splitOwners(owners string) []string {
+	return strings.FieldsFunc(owners, func(r rune) bool {
+		return string(r) == ownersSeparator
+	})
+}
+
+// quotaKeys returns keys of owner's quota, they have the same hash tag.
+func quotaKeys(owner string) (string, string) {
+	key := quotaPrefix + owner
+	return tagKey(key, "items"), tagKey(key, "sizes")
+}
+
+// Reserve adds saved item with content size to owner's quota, now is current time
+// to remove expired items. It returns false if the quota is exceeded.
+func (q *Quota) Reserve(c redis.Conn, owner string, item *Item, size int, now time.Time) (bool, error) {
+	items, sizes := quotaKeys(owner)
+	err := bind(c, items)
+	if err != nil {
+		return false, err
+	}
+	expiration := now.Add(time.Duration(item.TTL) * time.Second)
+	return redis.Bool(quotaScript.Do(c, items, sizes,
+		now.UnixNano()/int64(time.Millisecond), q.Count, q.Bytes,
+		item.Key, size, expiration.UnixNano()/int64(time.Millisecond),
+	))
+}
+
+// Reset returns the earliest expiration time of owner's items, the quota gets free space
+// not later than this time. It's zero time if the quota is empty.
+func Reset(c redis.Conn, owner string) (time.Time, error) {
+	items, _ := quotaKeys(owner)
+	err := bind(c, items)
+	if err != nil {
+		return time.Time{}, err
+	}
+	values, err := redis.Values(c.Do("ZRANGE", items, 0, 0, "WITHSCORES"))
+	if (err != nil) || (len(values) < 2) {
+		return time.Time{}, err
+	}
+	ms, err := redis.Int64(values[1], nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// Release removes deleted item from owner's quota.
+func Release(c redis.Conn, owner, key string) error {
+	items, sizes := quotaKeys(owner)
+	err := bind(c, items)
+	if err != nil {
+		return err
+	}
+	_, err = releaseScript.Do(c, items, sizes, key)
+	return err
+}
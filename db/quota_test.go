@@ -0,0 +1,96 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestQuota_Reserve(t *testing.T) {
+	const owner = "ip:192.0.2.100"
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	items, sizes := quotaKeys(owner)
+	defer func() {
+		_, err = conn.Do("DEL", items, sizes)
+		if err != nil {
+			t.Errorf("failed delete quota: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	_, err = conn.Do("DEL", items, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (&Quota{}).Enabled() {
+		t.Error("empty quota is enabled")
+	}
+	q := &Quota{Count: 3, Bytes: 10}
+	cases := []struct {
+		key  string
+		ttl  int
+		size int
+		ok   bool
+	}{
+		{key: "a", ttl: 60, size: 4, ok: true},
+		{key: "b", ttl: 60, size: 7, ok: false}, // total size 11
+		{key: "c", ttl: -1, size: 1, ok: true},  // already expired
+		{key: "d", ttl: 60, size: 1, ok: true},
+		{key: "e", ttl: 60, size: 1, ok: true},
+		{key: "f", ttl: 60, size: 1, ok: false}, // items number 4
+	}
+	for i, c := range cases {
+		ok, err := q.Reserve(conn, owner, &Item{Key: c.key, TTL: c.ttl}, c.size, time.Now())
+		if err != nil {
+			t.Fatalf("case=%v: %v", i, err)
+		}
+		if ok != c.ok {
+			t.Errorf("failed case=%v: %v", i, ok)
+		}
+	}
+	ttl, err := redis.Int(conn.Do("TTL", items))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (ttl < 1) || (ttl > 60) {
+		t.Errorf("failed quota ttl %v", ttl)
+	}
+	err = Release(conn, owner, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := q.Reserve(conn, owner, &Item{Key: "f", TTL: 60}, 8, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("failed reserve after release")
+	}
+	n, err := redis.Int(conn.Do("ZCARD", items))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("failed quota items %v", n)
+	}
+	// unlimited items number
+	q.Count = 0
+	ok, err = q.Reserve(conn, owner, &Item{Key: "g", TTL: 60}, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("failed unlimited reserve")
+	}
+}
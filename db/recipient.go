@@ -0,0 +1,105 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	ageArmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgpArmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+const (
+	// pgpKeyHeader is a header of armored PGP public key.
+	pgpKeyHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	// pgpMessageType is a type of armored PGP message.
+	pgpMessageType = "PGP MESSAGE"
+)
+
+// EncryptTo encrypts content to recipient's public key. The recipient is age one
+// ("age1...", one per line) or armored PGP public key. The result is armored,
+// so it can be decrypted only by the key holder even if server key and database are compromised.
+func EncryptTo(recipient, content string) (string, error) {
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return "", errors.New("empty recipient")
+	}
+	var (
+		b   strings.Builder
+		err error
+	)
+	if strings.HasPrefix(recipient, pgpKeyHeader) {
+		err = encryptPGP(&b, recipient, content)
+	} else {
+		err = encryptAge(&b, recipient, content)
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// encryptAge writes armored age file with the content.
+func encryptAge(out io.Writer, recipient, content string) error {
+	recipients, err := age.ParseRecipients(strings.NewReader(recipient))
+	if err != nil {
+		return err
+	}
+	a := ageArmor.NewWriter(out)
+	w, err := age.Encrypt(a, recipients...)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return a.Close()
+}
+
+// encryptPGP writes armored PGP message with the content.
+func encryptPGP(out io.Writer, recipient, content string) error {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(recipient))
+	if err != nil {
+		return err
+	}
+	a, err := pgpArmor.Encode(out, pgpMessageType, nil)
+	if err != nil {
+		return err
+	}
+	w, err := openpgp.Encrypt(a, entities, nil, &openpgp.FileHints{}, nil)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return a.Close()
+}
+
+// ArmorExt returns a file extension for content encrypted to a recipient,
+// it's empty for other content.
+func ArmorExt(content string) string {
+	switch {
+	case strings.HasPrefix(content, ageArmor.Header):
+		return ".age"
+	case strings.HasPrefix(content, "-----BEGIN "+pgpMessageType+"-----"):
+		return ".asc"
+	}
+	return ""
+}
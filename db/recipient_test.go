@@ -0,0 +1,125 @@
+package db
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	ageArmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgpArmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+func TestEncryptTo(t *testing.T) {
+	const content = "secret text"
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := EncryptTo(identity.Recipient().String()+"\n", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext := ArmorExt(result); ext != ".age" {
+		t.Errorf("failed age extension: %v", ext)
+	}
+	r, err := age.Decrypt(ageArmor.NewReader(strings.NewReader(result)), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("failed age content: %v", string(b))
+	}
+
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key strings.Builder
+	w, err := pgpArmor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entity.Serialize(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = EncryptTo(key.String(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext := ArmorExt(result); ext != ".asc" {
+		t.Errorf("failed PGP extension: %v", ext)
+	}
+	block, err := pgpArmor.Decode(strings.NewReader(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("failed PGP content: %v", string(b))
+	}
+
+	for i, recipient := range []string{"", "abc", "age1abc", pgpKeyHeader + "\nabc"} {
+		if _, err = EncryptTo(recipient, content); err == nil {
+			t.Errorf("expected error case=%v", i)
+		}
+	}
+	if ext := ArmorExt(content); ext != "" {
+		t.Errorf("unexpected extension: %v", ext)
+	}
+}
+
+func TestItem_NewRecipient(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		recipient string
+		ext       string
+		err       bool
+	}{
+		{recipient: "", ext: ""},
+		{recipient: identity.Recipient().String(), ext: ".age"},
+		{recipient: "bad recipient", err: true},
+	}
+	for i, c := range cases {
+		values := url.Values{"content": {"test"}, "ttl": {"60"}, "times": {"1"}, "recipient": {c.recipient}}
+		r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		item, err := New(r, time.Now(), 1, 60, 1)
+		if c.err {
+			if err == nil {
+				t.Errorf("expected error for case=%v", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for case=%v: %v", i, err)
+			continue
+		}
+		if ext := ArmorExt(item.Content); ext != c.ext {
+			t.Errorf("failed case=%v extension: %v", i, ext)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// TokenLen is a number of random bytes of request's private token.
+	TokenLen = 32
+	// E2EPrefix is a prefix of content encrypted in the browser to the requester's public key.
+	E2EPrefix = "e2e:"
+
+	// requestPrefix is a prefix of requests keys.
+	requestPrefix = "request:"
+)
+
+var (
+	// ErrRequestUsed is an error for a request that already has a secret.
+	ErrRequestUsed = errors.New("request is already used")
+
+	// requestSaveScript creates new request KEYS[1] only if the key doesn't exist yet,
+	// ARGV are token hash, public key, TTL, a number of readings of a secret and creator identity.
+	// It returns 1 if the request is saved and 0 for a key collision.
+	requestSaveScript = redis.NewScript(1, `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'token', ARGV[1], 'public_key', ARGV[2], 'ttl', ARGV[3], 'times', ARGV[4], 'creator', ARGV[5])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+	// requestFillScript sets item's key ARGV[1] for existing request KEYS[1] only once.
+	// It returns 0 if the request is not found, 1 if it's already used and 2 for success.
+	requestFillScript = redis.NewScript(1, `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+return redis.call('HSETNX', KEYS[1], 'item', ARGV[1]) + 1
+`)
+)
+
+// Request is a request of a secret from other person.
+// The sender uses a public upload link with the request's key,
+// and the requester gets a link of the sent secret using a private token.
+// Owners are quotas owners of the request, they are not stored.
+type Request struct {
+	Key       string
+	Token     string
+	PublicKey string
+	TTL       int
+	Times     int
+	ItemKey   string
+	Creator   string
+	Format    *KeyFormat
+	Owners    []string
+	hToken    string
+}
+
+// NewRequest returns new request from the form data, now is used for expiration time values.
+func NewRequest(r *http.Request, now time.Time, minTTL, maxTTL, times int) (*Request, error) {
+	value := r.PostFormValue("ttl")
+	if value == "" {
+		return nil, errors.New("required field ttl")
+	}
+	ttl, err := ParseTTL(value, now, minTTL, maxTTL)
+	if err != nil {
+		return nil, err
+	}
+	value = r.PostFormValue("times")
+	if value == "" {
+		return nil, errors.New("required field times")
+	}
+	attempts, err := validateRange(value, "times", times)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := r.PostFormValue("public_key")
+	if publicKey != "" {
+		// raw P-256 point generated by WebCrypto in the requester's browser
+		b, err := base64.RawURLEncoding.DecodeString(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		_, err = ecdh.P256().NewPublicKey(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Request{TTL: ttl, Times: attempts, PublicKey: publicKey}, nil
+}
+
+// tokenHash returns a hash of request's token, only it is stored.
+func tokenHash(token, key string) string {
+	h := sha256.Sum256([]byte(token + key))
+	return hex.EncodeToString(h[:])
+}
+
+// Save saves new request with unique key and private token.
+func (req *Request) Save(c redis.Conn) error {
+	_, err := req.SaveReserved(c, nil)
+	return err
+}
+
+// SaveReserved saves the request like Save, but every attempt to store it with new key
+// should be accepted by r before writing. The request is reserved as an item with
+// prefixed key and public key size, so it is counted by items quotas until expiration.
+// It returns false if the request is not accepted, r can be nil.
+func (req *Request) SaveReserved(c redis.Conn, r Reserver) (bool, error) {
+	var b [TokenLen]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return false, err
+	}
+	req.Token = hex.EncodeToString(b[:])
+	// loop to exclude collisions
+	for i := 0; i < maxCollisions; i++ {
+		req.Key, err = req.Format.NewKey()
+		if err != nil {
+			return false, err
+		}
+		req.hToken = tokenHash(req.Token, req.Key)
+		reserved := &Item{Key: requestPrefix + req.Key, TTL: req.TTL, Owners: req.Owners}
+		if r != nil {
+			ok, err := r.Reserve(reserved, len(req.PublicKey))
+			if err != nil || !ok {
+				req.Key = ""
+				return false, err
+			}
+		}
+		ok, err := req.store(c)
+		if (r != nil) && (err != nil || !ok) {
+			r.Release(reserved)
+		}
+		if err != nil {
+			req.Key = ""
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	req.Key = ""
+	return false, fmt.Errorf("can not get an unique request key [%v] after %v attempts", req.Format, maxCollisions)
+}
+
+// store writes the request if its key is not used yet.
+func (req *Request) store(c redis.Conn) (bool, error) {
+	key := requestPrefix + req.Key
+	err := bind(c, key)
+	if err != nil {
+		return false, err
+	}
+	return redis.Bool(requestSaveScript.Do(c, key, req.hToken, req.PublicKey, req.TTL, req.Times, req.Creator))
+}
+
+// Load reads request's data by its key, it returns false if the request is not found.
+func (req *Request) Load(c redis.Conn) (bool, error) {
+	key := requestPrefix + req.Key
+	err := bind(c, key)
+	if err != nil {
+		return false, err
+	}
+	values, err := redis.StringMap(c.Do("HGETALL", key))
+	if err != nil {
+		return false, err
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+	req.TTL, err = strconv.Atoi(values["ttl"])
+	if err != nil {
+		return false, err
+	}
+	req.Times, err = strconv.Atoi(values["times"])
+	if err != nil {
+		return false, err
+	}
+	req.hToken, req.PublicKey, req.ItemKey = values["token"], values["public_key"], values["item"]
+	req.Creator = values["creator"]
+	return true, nil
+}
+
+// CheckToken returns true if the token belongs to loaded request.
+func (req *Request) CheckToken(token string) bool {
+	h := tokenHash(token, req.Key)
+	return (req.hToken != "") && hmac.Equal([]byte(req.hToken), []byte(h))
+}
+
+// NewItem returns new item with the request's settings.
+// Content of end-to-end encrypted requests is checked,
+// so the sender's browser couldn't skip encryption.
+func (req *Request) NewItem(content string) (*Item, error) {
+	if content == "" {
+		return nil, errors.New("required field content")
+	}
+	if (req.PublicKey != "") && !strings.HasPrefix(content, E2EPrefix) {
+		return nil, errors.New("content is not encrypted to the request's public key")
+	}
+	// the secret is created for the requester, so it's recorded as a creator
+	return &Item{Content: content, TTL: req.TTL, Times: req.Times, Format: req.Format, Creator: req.Creator}, nil
+}
+
+// Fill links saved item with the request, only one item can be sent.
+// It returns ErrRequestUsed if the request already has a secret.
+func (req *Request) Fill(c redis.Conn, item *Item) error {
+	key := requestPrefix + req.Key
+	err := bind(c, key)
+	if err != nil {
+		return err
+	}
+	status, err := redis.Int(requestFillScript.Do(c, key, item.Key))
+	if err != nil {
+		return err
+	}
+	switch status {
+	case 0:
+		return errors.New("request is not found")
+	case 1:
+		return ErrRequestUsed
+	}
+	req.ItemKey = item.Key
+	return nil
+}
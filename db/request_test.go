@@ -0,0 +1,156 @@
+package db
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// testPublicKey is a raw P-256 public key like generated by WebCrypto.
+const testPublicKey = "BEI55eV6-Wc8c2gpjMvkOKvybS5CBn-Zm1X7sHoZNqOG0vtG3ZdtMj52OCDhHwMuYe3IB-0toqpkhv5h4JUings"
+
+func TestNewRequest(t *testing.T) {
+	cases := []struct {
+		params url.Values
+		err    bool
+	}{
+		{params: url.Values{"ttl": {"60"}, "times": {"1"}}},
+		{params: url.Values{"ttl": {"1h"}, "times": {"2"}, "public_key": {testPublicKey}}},
+		{params: url.Values{"times": {"1"}}, err: true},
+		{params: url.Values{"ttl": {"60"}}, err: true},
+		{params: url.Values{"ttl": {"60"}, "times": {"1"}, "public_key": {"abc"}}, err: true},
+		{params: url.Values{"ttl": {"60"}, "times": {"1"}, "public_key": {"abc+"}}, err: true},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("POST", "/request", strings.NewReader(c.params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		_, err := NewRequest(r, time.Now(), 10, 3600, 10)
+		if (err != nil) != c.err {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+	}
+}
+
+func TestRequest_SaveReserved(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	req := &Request{TTL: 60, Times: 1, PublicKey: testPublicKey}
+	defer func() {
+		_, err = conn.Do("DEL", requestPrefix+req.Key)
+		if err != nil {
+			t.Errorf("failed delete request: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	rejecter := &testReserver{}
+	ok, err := req.SaveReserved(conn, rejecter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || (req.Key != "") || (len(rejecter.keys) != 1) {
+		t.Errorf("rejected request was saved: %q", req.Key)
+	}
+	reserver := &testReserver{accept: true}
+	ok, err = req.SaveReserved(conn, reserver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("request was not saved")
+	}
+	if (len(reserver.keys) != 1) || (reserver.keys[0] != requestPrefix+req.Key) || (reserver.sizes[0] != len(testPublicKey)) {
+		t.Errorf("unexpected reservations: %v, %v", reserver.keys, reserver.sizes)
+	}
+	exists, err := redis.Bool(conn.Do("EXISTS", requestPrefix+req.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || (reserver.released != 0) {
+		t.Errorf("reserved request is not saved, released %d", reserver.released)
+	}
+}
+
+func TestRequest_Fill(t *testing.T) {
+	pool, err := readCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := pool.Get()
+	req := &Request{TTL: 60, Times: 1, PublicKey: testPublicKey}
+	defer func() {
+		_, err = conn.Do("DEL", requestPrefix+req.Key)
+		if err != nil {
+			t.Errorf("failed delete request: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("close connection errror: %v", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Errorf("close pool errror: %v", err)
+		}
+	}()
+	err = req.Save(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Request{Key: req.Key}
+	ok, err := loaded.Load(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || (loaded.PublicKey != testPublicKey) || (loaded.TTL != 60) || (loaded.ItemKey != "") {
+		t.Errorf("failed loaded request: %v", loaded)
+	}
+	if loaded.CheckToken("abc") || loaded.CheckToken("") {
+		t.Error("invalid token is accepted")
+	}
+	if !loaded.CheckToken(req.Token) {
+		t.Error("valid token is rejected")
+	}
+	if _, err = loaded.NewItem("plain text"); err == nil {
+		t.Error("expected error for not encrypted content")
+	}
+	item, err := loaded.NewItem(E2EPrefix + "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Key = "test-item"
+	err = loaded.Fill(conn, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loaded.Fill(conn, &Item{Key: "other-item"})
+	if err != ErrRequestUsed {
+		t.Errorf("expected used request error: %v", err)
+	}
+	ok, err = loaded.Load(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || (loaded.ItemKey != item.Key) {
+		t.Errorf("failed item key: %v", loaded.ItemKey)
+	}
+	absent := &Request{Key: "absent"}
+	if ok, err = absent.Load(conn); ok || (err != nil) {
+		t.Errorf("failed absent request: %v", err)
+	}
+	if err = absent.Fill(conn, item); err == nil {
+		t.Error("expected error for absent request")
+	}
+}
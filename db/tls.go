@@ -0,0 +1,85 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// TLSCfg is TLS settings of redis connections.
+type TLSCfg struct {
+	Enabled    bool   `json:"enabled"`
+	CAFile     string `json:"ca_file"`
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	ServerName string `json:"server_name"`
+	SkipVerify bool   `json:"skip_verify"` // only for development
+}
+
+// Config returns TLS configuration or nil if TLS is disabled.
+func (t *TLSCfg) Config() (*tls.Config, error) {
+	if (t == nil) || !t.Enabled {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.SkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %v", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (t.CertFile != "") || (t.KeyFile != "") {
+		if (t.CertFile == "") || (t.KeyFile == "") {
+			return nil, errors.New("both client certificate and key files are required")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// checkNetwork validates connection network type and unix socket path.
+func (c *Cfg) checkNetwork() error {
+	switch c.Network {
+	case "", "tcp", "tcp4", "tcp6":
+		if c.Network == "" {
+			c.Network = "tcp"
+		}
+		return nil
+	case "unix":
+		if c.Mode != "" && c.Mode != ModeSingle {
+			return fmt.Errorf("unix socket is not supported in %v mode", c.Mode)
+		}
+		if c.Host == "" {
+			return errors.New("unix socket path is required as host")
+		}
+		info, err := os.Stat(c.Host)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%v is not a unix socket", c.Host)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown redis network %v", c.Network)
+}
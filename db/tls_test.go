@@ -0,0 +1,157 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert creates self-signed certificate and key files in the directory.
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSCfg_Config(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := writeCert(t, dir)
+	badFile := filepath.Join(dir, "bad.pem")
+	err := ioutil.WriteFile(badFile, []byte("bad"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		cfg   *TLSCfg
+		ok    bool
+		isNil bool
+	}{
+		{cfg: nil, ok: true, isNil: true},
+		{cfg: &TLSCfg{CAFile: certFile}, ok: true, isNil: true},
+		{cfg: &TLSCfg{Enabled: true}, ok: true},
+		{cfg: &TLSCfg{Enabled: true, CAFile: certFile, ServerName: "localhost"}, ok: true},
+		{cfg: &TLSCfg{Enabled: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile}, ok: true},
+		{cfg: &TLSCfg{Enabled: true, SkipVerify: true}, ok: true},
+		{cfg: &TLSCfg{Enabled: true, CAFile: badFile}, ok: false},
+		{cfg: &TLSCfg{Enabled: true, CAFile: filepath.Join(dir, "absent.pem")}, ok: false},
+		{cfg: &TLSCfg{Enabled: true, CertFile: certFile}, ok: false},
+		{cfg: &TLSCfg{Enabled: true, CertFile: certFile, KeyFile: badFile}, ok: false},
+	}
+	for i, v := range cases {
+		config, err := v.cfg.Config()
+		if !v.ok {
+			if err == nil {
+				t.Errorf("expected error case=%v", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+			continue
+		}
+		if v.isNil {
+			if config != nil {
+				t.Errorf("unexpected config case=%v", i)
+			}
+			continue
+		}
+		if config == nil {
+			t.Errorf("empty config case=%v", i)
+			continue
+		}
+		if (config.ServerName != v.cfg.ServerName) || (config.InsecureSkipVerify != v.cfg.SkipVerify) {
+			t.Errorf("failed config case=%v", i)
+		}
+		if (v.cfg.CAFile != "") && (config.RootCAs == nil) {
+			t.Errorf("no CA case=%v", i)
+		}
+		if (v.cfg.CertFile != "") && (len(config.Certificates) != 1) {
+			t.Errorf("no client certificate case=%v", i)
+		}
+	}
+}
+
+func TestCfg_checkNetwork(t *testing.T) {
+	dir := tempDir(t)
+	socket := filepath.Join(dir, "redis.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := l.Close(); err != nil {
+			t.Errorf("close listener error: %v", err)
+		}
+	}()
+	regular := filepath.Join(dir, "regular")
+	err = ioutil.WriteFile(regular, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		cfg *Cfg
+		ok  bool
+	}{
+		{cfg: &Cfg{}, ok: true},
+		{cfg: &Cfg{Network: "tcp"}, ok: true},
+		{cfg: &Cfg{Network: "tcp6"}, ok: true},
+		{cfg: &Cfg{Network: "unix", Host: socket}, ok: true},
+		{cfg: &Cfg{Network: "unix", Host: socket, Mode: ModeCluster}, ok: false},
+		{cfg: &Cfg{Network: "unix"}, ok: false},
+		{cfg: &Cfg{Network: "unix", Host: filepath.Join(dir, "absent.sock")}, ok: false},
+		{cfg: &Cfg{Network: "unix", Host: regular}, ok: false},
+		{cfg: &Cfg{Network: "udp"}, ok: false},
+	}
+	for i, v := range cases {
+		err := v.cfg.checkNetwork()
+		if v.ok {
+			if err != nil {
+				t.Errorf("unexpected error case=%v: %v", i, err)
+			}
+		} else if err == nil {
+			t.Errorf("expected error case=%v", i)
+		}
+	}
+	c := &Cfg{Network: "unix", Host: socket, Port: 6379}
+	if addr := c.RedisAddr(); addr != socket {
+		t.Errorf("failed socket address: %v", addr)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rgDays matches days and weeks parts of human durations, like "3d" or "1.5w".
+var rgDays = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// parseDuration parses Go duration string with additional units "d" (day) and "w" (week).
+func parseDuration(value string) (time.Duration, error) {
+	var err error
+	value = rgDays.ReplaceAllStringFunc(value, func(s string) string {
+		m := rgDays.FindStringSubmatch(s)
+		n, e := strconv.ParseFloat(m[1], 64)
+		if e != nil {
+			err = e
+			return s
+		}
+		hours := 24.0
+		if m[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(n*hours, 'f', -1, 64) + "h"
+	})
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(value)
+}
+
+// ParseTTL converts value to a number of seconds and checks that it is in a range [min; max].
+// The value can be integer seconds, human duration ("90m", "3d", "1d12h")
+// or absolute RFC 3339 expiration time ("2018-12-31T23:59:00Z").
+func ParseTTL(value string, now time.Time, min, max int) (int, error) {
+	var seconds int
+	value = strings.TrimSpace(value)
+	if n, err := strconv.Atoi(value); err == nil {
+		seconds = n
+	} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+		seconds = int(math.Ceil(t.Sub(now).Seconds()))
+	} else {
+		d, err := parseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("field ttl=%v is not a duration or RFC 3339 time", value)
+		}
+		seconds = int(math.Ceil(d.Seconds()))
+	}
+	if (seconds < min) || (seconds > max) {
+		return 0, fmt.Errorf("field ttl=%v but available range [%v - %v] seconds", value, min, max)
+	}
+	return seconds, nil
+}
+
+// FormatTTL returns a number of seconds as a short value for ParseTTL,
+// the largest unit of days, hours or minutes without a remainder is used.
+func FormatTTL(seconds int) string {
+	for _, u := range []struct {
+		seconds int
+		name    string
+	}{{86400, "d"}, {3600, "h"}, {60, "m"}} {
+		if (seconds > 0) && (seconds%u.seconds == 0) {
+			return strconv.Itoa(seconds/u.seconds) + u.name
+		}
+	}
+	return strconv.Itoa(seconds)
+}
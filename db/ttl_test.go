@@ -0,0 +1,80 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	const (
+		min = 60
+		max = 7 * 24 * 3600
+	)
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value    string
+		expected int
+		ok       bool
+	}{
+		{"600", 600, true},
+		{" 3600 ", 3600, true},
+		{"90m", 5400, true},
+		{"1h30m", 5400, true},
+		{"1.5h", 5400, true},
+		{"3d", 3 * 24 * 3600, true},
+		{"1d12h", 36 * 3600, true},
+		{"0.5d", 12 * 3600, true},
+		{"1w", 7 * 24 * 3600, true},
+		{"1500ms", 0, false},
+		{"59s", 0, false},
+		{"8d", 0, false},
+		{"2w", 0, false},
+		{"-5m", 0, false},
+		{"0", 0, false},
+		{"2018-10-01T13:00:00Z", 3600, true},
+		{"2018-10-01T16:00:00+03:00", 3600, true},
+		{"2018-10-01T13:00:00.5Z", 3601, true},
+		{"2018-10-01T11:00:00Z", 0, false},
+		{"2018-12-01T12:00:00Z", 0, false},
+		{"2018-10-01 13:00:00", 0, false},
+		{"tomorrow", 0, false},
+		{"", 0, false},
+	}
+	for i, v := range cases {
+		ttl, err := ParseTTL(v.value, now, min, max)
+		if v.ok {
+			if err != nil {
+				t.Errorf("unexpected error case=%v: %v", i, err)
+			} else if ttl != v.expected {
+				t.Errorf("failed case=%v: %v", i, ttl)
+			}
+		} else if err == nil {
+			t.Errorf("expected error case=%v, ttl=%v", i, ttl)
+		}
+	}
+}
+
+func TestFormatTTL(t *testing.T) {
+	cases := []struct {
+		seconds  int
+		expected string
+	}{
+		{86400, "1d"},
+		{7 * 86400, "7d"},
+		{3600, "1h"},
+		{90000, "25h"},
+		{5400, "90m"},
+		{61, "61"},
+		{0, "0"},
+	}
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, v := range cases {
+		value := FormatTTL(v.seconds)
+		if value != v.expected {
+			t.Errorf("failed case=%v: %v", i, value)
+		}
+		if ttl, err := ParseTTL(value, now, 0, v.seconds); (err != nil) || (ttl != v.seconds) {
+			t.Errorf("failed parsing case=%v: %v, %v", i, ttl, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package db
+
+// words is a list of short distinct English words for keys dictation,
+// every word encodes one byte, so the list has exactly 256 items.
+var words = [256]string{
+	"area", "army", "baby", "ball", "band", "bank", "base", "bath", "bear", "beat",
+	"bell", "belt", "bird", "blow", "blue", "boat", "body", "bone", "book", "boot",
+	"boss", "bowl", "burn", "cake", "call", "camp", "card", "cart", "case", "cash",
+	"cave", "chef", "chin", "city", "clay", "coal", "coat", "code", "coin", "cook",
+	"corn", "crew", "crop", "cube", "dart", "data", "dawn", "deck", "deer", "desk",
+	"dial", "diet", "dirt", "dish", "dive", "dock", "door", "dove", "drum", "duck",
+	"dust", "east", "echo", "edge", "exit", "face", "farm", "fern", "film", "fire",
+	"fish", "flag", "flow", "foam", "fold", "folk", "food", "foot", "fork", "fort",
+	"fox", "frog", "fuel", "game", "gate", "gear", "gift", "glow", "goat", "gold",
+	"golf", "gown", "grid", "grin", "gulf", "hair", "hall", "hand", "harp", "hawk",
+	"heat", "herb", "hero", "hill", "hint", "hive", "home", "hook", "horn", "host",
+	"hour", "idea", "inch", "iron", "item", "jade", "jazz", "jump", "jury", "kelp",
+	"kick", "king", "kite", "knee", "knot", "lake", "lamp", "land", "lane", "lava",
+	"lawn", "leaf", "lens", "lift", "lily", "lime", "line", "lion", "list", "loaf",
+	"lock", "loft", "lunar", "mail", "main", "mango", "map", "mask", "maze", "meal",
+	"melt", "menu", "milk", "mint", "mist", "moon", "moss", "moth", "nail", "navy",
+	"neck", "nest", "news", "node", "noon", "nose", "note", "oak", "oath", "ocean",
+	"olive", "onion", "oval", "oven", "owl", "pact", "page", "palm", "park", "path",
+	"peak", "pear", "pen", "pine", "pink", "plan", "plum", "poem", "pond", "pony",
+	"pool", "port", "quiz", "race", "rain", "ramp", "raven", "reef", "rice", "ring",
+	"river", "road", "rock", "roof", "rope", "rose", "ruby", "rule", "sage", "sail",
+	"salt", "sand", "seal", "seed", "shoe", "silk", "sing", "site", "snow", "soap",
+	"sock", "sofa", "song", "soup", "star", "stem", "sun", "swan", "table", "tail",
+	"tango", "taxi", "team", "tent", "tide", "tiger", "toad", "tone", "tool", "tree",
+	"tulip", "tuna", "union", "vase", "veil", "vest", "view", "vine", "wave", "wax",
+	"whale", "wind", "wing", "wolf", "yard", "zebra",
+}
@@ -0,0 +1,297 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package email implements delivery of secrets links by SMTP.
+// Every recipient gets a separate message, so recipients don't see each other.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Connection security modes.
+const (
+	TLSNone     = "none"
+	TLSStart    = "starttls"
+	TLSImplicit = "tls"
+)
+
+const (
+	// defaultPort is SMTP submission port.
+	defaultPort = 587
+	// defaultTimeout is SMTP session timeout in seconds.
+	defaultTimeout = 10
+	// defaultMaxRecipients is maximum number of recipients of one secret.
+	defaultMaxRecipients = 5
+	// defaultLimit is maximum number of messages of one sender during LimitWindow.
+	defaultLimit = 20
+
+	// LimitWindow is a period of messages rate limit in seconds.
+	LimitWindow = 3600
+)
+
+// Cfg is SMTP server settings. TLS is connection security mode, "starttls" by default.
+// Username and Password are used for PLAIN authentication if username is not empty.
+// Only authenticated creators can send messages if Anonymous is false,
+// and every sender can send no more than Limit messages during LimitWindow.
+type Cfg struct {
+	Host          string `json:"host"`
+	Port          uint   `json:"port"`
+	TLS           string `json:"tls"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	From          string `json:"from"`
+	Timeout       int64  `json:"timeout"`
+	MaxRecipients int    `json:"max_recipients"`
+	Anonymous     bool   `json:"anonymous"`
+	Limit         int    `json:"limit"`
+	from          *mail.Address
+	timeout       time.Duration
+	tlsConfig     *tls.Config
+}
+
+// Message is an email of one recipient, Body is plain text and Date is its creation time.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	Date    time.Time
+}
+
+// Init checks the settings.
+func (c *Cfg) Init() error {
+	if c.Host == "" {
+		return errors.New("empty mail host")
+	}
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	switch c.TLS {
+	case "":
+		c.TLS = TLSStart
+	case TLSNone, TLSStart, TLSImplicit:
+	default:
+		return fmt.Errorf("unknown mail tls mode %q", c.TLS)
+	}
+	from, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return fmt.Errorf("invalid mail from: %w", err)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Timeout < 1 {
+		return errors.New("mail timeout should be positive")
+	}
+	if c.MaxRecipients == 0 {
+		c.MaxRecipients = defaultMaxRecipients
+	}
+	if c.MaxRecipients < 1 {
+		return errors.New("mail max_recipients should be positive")
+	}
+	if c.Limit == 0 {
+		c.Limit = defaultLimit
+	}
+	if c.Limit < c.MaxRecipients {
+		return errors.New("mail limit should not be less than max_recipients")
+	}
+	c.from, c.timeout = from, time.Duration(c.Timeout)*time.Second
+	c.tlsConfig = &tls.Config{ServerName: c.Host, MinVersion: tls.VersionTLS12}
+	return nil
+}
+
+// Enabled returns true if email delivery is configured.
+func (c *Cfg) Enabled() bool {
+	return c != nil
+}
+
+// Allowed returns true if the creator can send messages,
+// an empty one is used for anonymous requests.
+func (c *Cfg) Allowed(creator string) bool {
+	return c.Enabled() && ((creator != "") || c.Anonymous)
+}
+
+// Addr returns SMTP server address.
+func (c *Cfg) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.FormatUint(uint64(c.Port), 10))
+}
+
+// Recipients returns email addresses from comma or space separated list,
+// it returns an error for invalid addresses or if there are too many of them.
+func (c *Cfg) Recipients(value string) ([]string, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return (r == ',') || (r == ';') || (r == ' ') || (r == '\t') || (r == '\r') || (r == '\n')
+	})
+	result := make([]string, 0, len(fields))
+	unique := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		address, err := mail.ParseAddress(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email %q: %w", field, err)
+		}
+		if key := strings.ToLower(address.Address); !unique[key] {
+			unique[key] = true
+			result = append(result, address.Address)
+		}
+	}
+	if len(result) > c.MaxRecipients {
+		return nil, fmt.Errorf("too many recipients %v, maximum is %v", len(result), c.MaxRecipients)
+	}
+	return result, nil
+}
+
+// Send sends messages in one SMTP session. It returns delivery errors of every message,
+// all of them are the same if the session is failed.
+func (c *Cfg) Send(ctx context.Context, messages []*Message) []error {
+	errs := make([]error, len(messages))
+	client, err := c.dial(ctx)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	for i, m := range messages {
+		errs[i] = c.send(client, m)
+		if errs[i] != nil {
+			// the session can be in unknown state after failed command
+			if e := client.Reset(); e != nil {
+				for j := i + 1; j < len(errs); j++ {
+					errs[j] = e
+				}
+				_ = client.Close()
+				return errs
+			}
+		}
+	}
+	if e := client.Quit(); e != nil {
+		_ = client.Close()
+	}
+	return errs
+}
+
+// dial connects to SMTP server and authenticates the client.
+// The whole session should be finished before the timeout.
+func (c *Cfg) dial(ctx context.Context) (*smtp.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr())
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if c.TLS == TLSImplicit {
+		conn = tls.Client(conn, c.tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	err = c.hello(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// hello starts TLS and authenticates the client if it's needed.
+func (c *Cfg) hello(client *smtp.Client) error {
+	if c.TLS == TLSStart {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("mail server doesn't support STARTTLS")
+		}
+		err := client.StartTLS(c.tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if c.Username == "" {
+		return nil
+	}
+	return client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host))
+}
+
+// send sends one message.
+func (c *Cfg) send(client *smtp.Client, m *Message) error {
+	data, err := c.build(m)
+	if err != nil {
+		return err
+	}
+	err = client.Mail(c.from.Address)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(m.To)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// build returns message data with headers and quoted-printable UTF-8 body.
+func (c *Cfg) build(m *Message) ([]byte, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", c.from.String()},
+		{"To", (&mail.Address{Address: m.To}).String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", m.Date.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(id) + "@" + c.from.Address[strings.LastIndex(c.from.Address, "@")+1:] + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+		// automatic replies to secrets notifications are useless
+		{"Auto-Submitted", "auto-generated"},
+	}
+	for _, h := range headers {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	w := quotedprintable.NewWriter(&buf)
+	// text mode writer converts line endings to CRLF
+	_, err = w.Write([]byte(m.Body))
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/enigma/email/emailtest"
+)
+
+func TestCfg_Init(t *testing.T) {
+	cases := []struct {
+		c   *Cfg
+		err bool
+	}{
+		{c: &Cfg{Host: "localhost", From: "enigma@example.com"}},
+		{c: &Cfg{Host: "localhost", From: "Enigma <enigma@example.com>", TLS: TLSImplicit, Port: 465}},
+		{c: &Cfg{From: "enigma@example.com"}, err: true},
+		{c: &Cfg{Host: "localhost"}, err: true},
+		{c: &Cfg{Host: "localhost", From: "enigma"}, err: true},
+		{c: &Cfg{Host: "localhost", From: "enigma@example.com", TLS: "ssl"}, err: true},
+		{c: &Cfg{Host: "localhost", From: "enigma@example.com", Timeout: -1}, err: true},
+		{c: &Cfg{Host: "localhost", From: "enigma@example.com", MaxRecipients: -1}, err: true},
+		{c: &Cfg{Host: "localhost", From: "enigma@example.com", MaxRecipients: 10, Limit: 5}, err: true},
+	}
+	for i, c := range cases {
+		err := c.c.Init()
+		if (err != nil) != c.err {
+			t.Errorf("failed case=%v: %v", i, err)
+		}
+	}
+	c := cases[0].c
+	if (c.Port != defaultPort) || (c.TLS != TLSStart) || (c.Addr() != "localhost:587") || (c.Limit != defaultLimit) {
+		t.Errorf("failed defaults: %+v", c)
+	}
+	if !c.Allowed("user") || c.Allowed("") {
+		t.Error("anonymous messages should be allowed only explicitly")
+	}
+	c.Anonymous = true
+	if !c.Allowed("") {
+		t.Error("anonymous messages are not allowed")
+	}
+	var disabled *Cfg
+	if disabled.Enabled() || disabled.Allowed("user") {
+		t.Error("nil settings should be disabled")
+	}
+}
+
+func TestCfg_Recipients(t *testing.T) {
+	c := &Cfg{Host: "localhost", From: "enigma@example.com", MaxRecipients: 2}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		value    string
+		expected []string
+		err      bool
+	}{
+		{value: "", expected: []string{}},
+		{value: "a@example.com", expected: []string{"a@example.com"}},
+		{value: " a@example.com,b@example.com; A@example.com\n", expected: []string{"a@example.com", "b@example.com"}},
+		{value: "a@example.com b@example.com c@example.com", err: true},
+		{value: "a@example.com, b", err: true},
+	}
+	for i, x := range cases {
+		result, err := c.Recipients(x.value)
+		if (err != nil) != x.err {
+			t.Errorf("failed case=%v: %v", i, err)
+			continue
+		}
+		if strings.Join(result, ",") != strings.Join(x.expected, ",") {
+			t.Errorf("failed case=%v: %v", i, result)
+		}
+	}
+}
+
+func TestCfg_Send(t *testing.T) {
+	s, err := emailtest.NewServer("rejected@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := &Cfg{Host: s.Host, Port: s.Port, TLS: TLSNone, Username: "user", Password: "pwd", From: "Enigma <enigma@example.com>"}
+	if err = c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	messages := []*Message{
+		{To: "a@example.com", Subject: "Секрет для вас", Body: "Link:\nhttp://localhost/" + strings.Repeat("ab", 64) + "\n", Date: date},
+		{To: "rejected@example.com", Subject: "Secret", Body: "text", Date: date},
+		{To: "b@example.com", Subject: "Password", Body: "password", Date: date},
+	}
+	errs := c.Send(context.Background(), messages)
+	if (errs[0] != nil) || (errs[1] == nil) || (errs[2] != nil) {
+		t.Fatalf("failed delivery: %v", errs)
+	}
+	received := s.Messages()
+	if len(received) != 2 {
+		t.Fatalf("failed messages: %v", received)
+	}
+	for i, x := range []*Message{messages[0], messages[2]} {
+		r := received[i]
+		if (r.From != "enigma@example.com") || (len(r.To) != 1) || (r.To[0] != x.To) || (r.User != "user") {
+			t.Errorf("failed envelope %v: %+v", i, r)
+		}
+		msg, err := mail.ReadMessage(strings.NewReader(r.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (subject != x.Subject) || (msg.Header.Get("To") != "<"+x.To+">") || (msg.Header.Get("Message-Id") == "") {
+			t.Errorf("failed headers %v: %v", i, msg.Header)
+		}
+		if d, err := msg.Header.Date(); (err != nil) || !d.Equal(date) {
+			t.Errorf("failed date %v: %v", i, msg.Header.Get("Date"))
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the stand-in normalizes line endings of received data
+		if strings.TrimSuffix(string(body), "\n") != strings.TrimSuffix(x.Body, "\n") {
+			t.Errorf("failed body %v: %q", i, body)
+		}
+	}
+	// STARTTLS is required by default
+	c.TLS = TLSStart
+	errs = c.Send(context.Background(), messages[:1])
+	if errs[0] == nil {
+		t.Error("expected STARTTLS error")
+	}
+	// closed server
+	closed, err := emailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = closed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c.TLS, c.Port = TLSNone, closed.Port
+	errs = c.Send(context.Background(), messages)
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("failed case=%v: expected error for closed %v", i, closed.Addr())
+		}
+	}
+}
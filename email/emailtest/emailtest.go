@@ -0,0 +1,166 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package emailtest provides a local SMTP server stand-in for tests.
+package emailtest
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a received message.
+type Message struct {
+	From string
+	To   []string
+	User string
+	Data string
+}
+
+// Server is SMTP server without TLS listening on a loopback address.
+// It accepts all messages except ones to rejected recipients.
+type Server struct {
+	Host     string
+	Port     uint
+	listener net.Listener
+	reject   map[string]bool
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts new server, reject are recipients addresses which are refused.
+func NewServer(reject ...string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{Host: addr.IP.String(), Port: uint(addr.Port), listener: listener, reject: make(map[string]bool)}
+	for _, to := range reject {
+		s.reject[to] = true
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns server address.
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.FormatUint(uint64(s.Port), 10))
+}
+
+// Messages returns received messages.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server and waits its sessions.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// address returns an address from "FROM:<address> [params]" or "TO:<address>" command argument.
+func address(arg string) string {
+	_, value, _ := strings.Cut(arg, ":")
+	value, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+	return strings.Trim(value, "<>")
+}
+
+// serve handles one SMTP session.
+func (s *Server) serve(conn net.Conn) {
+	c := textproto.NewConn(conn)
+	defer func() {
+		_ = c.Close()
+	}()
+	var m Message
+	reply := func(code int, text string) bool {
+		return c.PrintfLine("%d %s", code, text) == nil
+	}
+	if !reply(220, "localhost ESMTP emailtest") {
+		return
+	}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		ok := true
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			ok = c.PrintfLine("250-localhost") == nil && c.PrintfLine("250-8BITMIME") == nil && reply(250, "AUTH PLAIN")
+		case "AUTH":
+			mechanism, value, _ := strings.Cut(arg, " ")
+			b, err := base64.StdEncoding.DecodeString(value)
+			parts := strings.Split(string(b), "\x00")
+			if (mechanism != "PLAIN") || (err != nil) || (len(parts) != 3) {
+				ok = reply(535, "authentication failed")
+				break
+			}
+			m.User = parts[1]
+			ok = reply(235, "authenticated")
+		case "MAIL":
+			m.From, m.To = address(arg), nil
+			ok = reply(250, "ok")
+		case "RCPT":
+			to := address(arg)
+			if s.reject[to] {
+				ok = reply(550, "mailbox unavailable")
+				break
+			}
+			m.To = append(m.To, to)
+			ok = reply(250, "ok")
+		case "DATA":
+			if !reply(354, "end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			m.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, m)
+			s.mu.Unlock()
+			m = Message{User: m.User}
+			ok = reply(250, "queued")
+		case "RSET":
+			m = Message{User: m.User}
+			ok = reply(250, "ok")
+		case "NOOP":
+			ok = reply(250, "ok")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			ok = reply(502, "command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
@@ -27,6 +27,8 @@ const (
 	Name = "Enigma"
 	// Config is default configuration file name
 	Config = "config.json"
+	// expiredRetry is a delay before expired items watching restart.
+	expiredRetry = 5 * time.Second
 )
 
 var (
@@ -46,19 +48,24 @@ var (
 		log.Ldate|log.Ltime|log.Lshortfile)
 )
 
-func getVersion(w http.ResponseWriter, cfg *conf.Cfg) error {
-	conn := cfg.Connection()
-	defer func() {
-		err := conn.Close()
-		if err != nil {
+// watchExpired writes audit events about expired items, it restarts watching after failures
+// using the current configuration. Events are logged by the configuration that is current
+// at the moment of expiration, so reloading doesn't break the watching.
+func watchExpired(store *conf.Store) {
+	for {
+		cfg := store.Cfg()
+		conn := cfg.Connection()
+		err := db.WatchExpired(conn, cfg.Redis.Db, func(key string) {
+			if err := store.LogExpired(key); err != nil {
+				loggerError.Printf("failed audit event: %v", err)
+			}
+		})
+		loggerError.Printf("expired items watching failed: %v", err)
+		if err = conn.Close(); err != nil {
 			loggerError.Printf("failed connection close: %v\n", err)
 		}
-	}()
-	_, err := fmt.Fprintf(w,
-		"%v\nVersion: %v\nRevision: %v\nBuild date: %v\nGo version: %v\nDb is OK: %v\n",
-		Name, Version, Revision, BuildDate, GoVersion, db.IsOk(conn),
-	)
-	return err
+		time.Sleep(expiredRetry)
+	}
 }
 
 func main() {
@@ -78,59 +85,62 @@ func main() {
 		return
 	}
 
-	cfg, err := conf.New(*config)
+	store, err := conf.NewStore(*config)
 	if err != nil {
 		panic(err)
 	}
+	store.ErrorLog = loggerError
 	defer func() {
-		err := cfg.Close()
+		err := store.Close()
 		if err != nil {
 			loggerError.Println("failed connection close after stop")
 		}
 	}()
+	cfg := store.Cfg()
+	if cfg.Audit.Enabled() && (cfg.Redis.Mode != db.ModeCluster) {
+		// cluster nodes send notifications only about own keys
+		go watchExpired(store)
+	}
+	server := web.NewServer(cfg, nil, loggerError, nil)
+	server.Version = fmt.Sprintf("%v\nVersion: %v\nRevision: %v\nBuild date: %v\nGo version: %v",
+		Name, Version, Revision, BuildDate, GoVersion)
+	server.AccessLog = loggerInfo
 	timeout := cfg.HandleTimeout()
 	srv := &http.Server{
 		Addr:           cfg.Addr(),
-		Handler:        http.DefaultServeMux,
+		Handler:        server.Handler(),
 		ReadTimeout:    timeout,
 		WriteTimeout:   timeout,
 		MaxHeaderBytes: 1 << 20, // 1MB
 		ErrorLog:       loggerInfo,
 	}
 	loggerInfo.Printf("\n%v\nlisten addr: %v\n", versionInfo, srv.Addr)
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		var err error
-		start, code := time.Now(), http.StatusOK
-		defer func() {
-			loggerInfo.Printf("%-5v %v\t%-12v\t%v",
-				r.Method,
-				code,
-				time.Since(start),
-				r.URL.String(),
-			)
-		}()
-		switch r.URL.Path {
-		case "/version":
-			code, err = http.StatusOK, getVersion(w, cfg)
-		case "/":
-			code, err = web.Index(w, r, cfg)
-		default:
-			code, err = web.Read(w, r, cfg)
-		}
-		if err != nil {
-			loggerError.Println(err)
-		}
-	})
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt, os.Signal(syscall.SIGTERM))
-		<-sigint
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, os.Signal(syscall.SIGTERM), os.Signal(syscall.SIGHUP))
+		for s := range signals {
+			if s != syscall.SIGHUP {
+				break
+			}
+			if err := store.Reload(); err != nil {
+				loggerError.Printf("configuration reload failed: %v", err)
+			} else {
+				server.Reload(store.Cfg())
+				loggerInfo.Println("configuration reloaded")
+			}
+		}
+		// load balancers stop sending new requests before the server shutdown
+		server.Health().SetReady(false)
+		delay, deadline := store.Cfg().Shutdown()
+		time.Sleep(delay)
 
-		if err := srv.Shutdown(context.Background()); err != nil {
-			loggerInfo.Printf("HTTP server Shutdown: %v", err)
+		ctx, cancel := context.WithTimeout(context.Background(), deadline)
+		if err := srv.Shutdown(ctx); err != nil {
+			loggerInfo.Printf("HTTP server Shutdown: %v, active requests: %v", err, server.Health().Active())
 		}
+		cancel()
 		close(idleConnsClosed)
 	}()
 
@@ -0,0 +1,125 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+// Package i18n contains translation catalog of UI strings.
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLang is a language for absent translations.
+const DefaultLang = "en"
+
+// Messages is a set of translated UI strings for one language.
+type Messages map[string]string
+
+// Get returns translated string by key or the key itself if it is unknown.
+func (m Messages) Get(key string) string {
+	if value, ok := m[key]; ok {
+		return value
+	}
+	return key
+}
+
+// Catalog contains messages for all supported languages.
+type Catalog map[string]Messages
+
+// Load reads "<lang>.json" translation files from fsys.
+// Absent strings of every language are taken from the default one.
+func Load(fsys fs.FS) (Catalog, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	c := make(Catalog, len(names))
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m := Messages{}
+		err = json.Unmarshal(data, &m)
+		if err != nil {
+			return nil, fmt.Errorf("translation file %v: %v", name, err)
+		}
+		lang := strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))
+		c[lang] = m
+	}
+	base, ok := c[DefaultLang]
+	if !ok {
+		return nil, errors.New("no default language translation")
+	}
+	for lang, m := range c {
+		if lang == DefaultLang {
+			continue
+		}
+		for key, value := range base {
+			if _, ok := m[key]; !ok {
+				m[key] = value
+			}
+		}
+	}
+	return c, nil
+}
+
+// Negotiate returns the best supported language for Accept-Language header value.
+func (c Catalog) Negotiate(header string) string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = value
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{tag, q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+	for _, w := range langs {
+		if _, ok := c[w.lang]; ok {
+			return w.lang
+		}
+		// primary language subtag, "ru" for "ru-RU"
+		if i := strings.IndexAny(w.lang, "-_"); i > 0 {
+			if _, ok := c[w.lang[:i]]; ok {
+				return w.lang[:i]
+			}
+		}
+	}
+	return DefaultLang
+}
+
+// Messages returns translated strings for language lang.
+func (c Catalog) Messages(lang string) Messages {
+	if m, ok := c[lang]; ok {
+		return m
+	}
+	return c[DefaultLang]
+}
@@ -0,0 +1,68 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func testCatalog() (Catalog, error) {
+	fsys := fstest.MapFS{
+		"en.json": {Data: []byte(`{"title": "Enigma", "submit": "Submit"}`)},
+		"ru.json": {Data: []byte(`{"submit": "Отправить"}`)},
+		"de.json": {Data: []byte(`{}`)},
+	}
+	return Load(fsys)
+}
+
+func TestLoad(t *testing.T) {
+	c, err := testCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c); n != 3 {
+		t.Errorf("failed languages number: %v", n)
+	}
+	m := c.Messages("ru")
+	if s := m.Get("submit"); s != "Отправить" {
+		t.Errorf("failed translation: %v", s)
+	}
+	if s := m.Get("title"); s != "Enigma" {
+		t.Errorf("failed default translation: %v", s)
+	}
+	if s := m.Get("unknown"); s != "unknown" {
+		t.Errorf("failed unknown translation: %v", s)
+	}
+	if s := c.Messages("fr").Get("submit"); s != "Submit" {
+		t.Errorf("failed unsupported language: %v", s)
+	}
+	_, err = Load(fstest.MapFS{"ru.json": {Data: []byte(`{}`)}})
+	if err == nil {
+		t.Error("expected error for absent default language")
+	}
+	_, err = Load(fstest.MapFS{"en.json": {Data: []byte(`{bad`)}})
+	if err == nil {
+		t.Error("expected error for bad json")
+	}
+}
+
+func TestCatalog_Negotiate(t *testing.T) {
+	c, err := testCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"":                            "en",
+		"ru":                          "ru",
+		"ru-RU,ru;q=0.9,en-US;q=0.8":  "ru",
+		"fr-CH, fr;q=0.9, en;q=0.8":   "en",
+		"en;q=0.5, de;q=0.7":          "de",
+		"fr, ru;q=0":                  "en",
+		"de-AT;q=0.3, RU-ru;q=0.4, *": "ru",
+		"ru;q=bad, de;q=0.9":          "ru",
+	}
+	for header, expected := range cases {
+		if lang := c.Negotiate(header); lang != expected {
+			t.Errorf("failed negotiation for %q: %v", header, lang)
+		}
+	}
+}
@@ -2,96 +2,100 @@
 // All rights reserved. Use of this source code is governed
 // by a MIT-style license that can be found in the LICENSE file.
 
-// Package page contains HTML text templates.
+// Package page contains default theme: HTML templates, static files, translations and email templates.
+// A custom theme is a directory with the same structure,
+// its files replace the embedded ones with the same names.
 package page
 
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+)
+
 const (
-	// Index is index page HTML template.
-	Index = `
-<!DOCTYPE html>
-<html>
-	<head>
-		<meta charset=utf-8>
-		<title>Enigma</title>
-	</head>
-	<body>
-		<h1>Enigma</h1>
-		<form method="POST">
-			<textarea name="content" cols="80" rows="8" placeholder="Your secret text" required></textarea><br>
-			TTL: <select name="ttl" required>
-				<option value='600'>10 minutes</option>
-				<option value='3600'>a hour</option>
-				<option value='86400' selected>a day</option>
-				<option value='604800'>a week</option>
-			</select>
-			times: <input type="number" name="times" min="1" max="1000" value="1" required>
-			password: <input type="password" name="password" placeholder="optional">
-			<input type="submit" value="Submit">
-		</form>
-		<p>
-			<small><a href="https://github.com/z0rr0/enigma" title="github.com/z0rr0/enigma">github.com</a></small>
-		</p>
-	</body>
-</html>
-`
-	// Error is error page HTML template.
-	Error = `
-<!DOCTYPE html>
-<html>
-	<head>
-		<meta charset=utf-8>
-		<title>Enigma - {{ .Title }}</title>
-	</head>
-	<body>
-		<h1><a href="/" title="Enigma">Enigma</a></h1>
-		<h4>{{ .Msg }}</h4>
-	</body>
-</html>
-`
-	// Result is HTML template for link sharing.
-	Result = `
-<!DOCTYPE html>
-<html>
-	<head>
-		<meta charset=utf-8>
-		<title>Enigma</title>
-	</head>
-	<body>
-		<h1><a href="/" title="Enigma">Enigma</a></h1>
-		<strong><a href="{{ .URL }}">{{ .URL }}</a></strong>
-	</body>
-</html>
-`
-	// Read is HTML template for data decryption.
-	Read = `
-<!DOCTYPE html>
-<html>
-	<head>
-		<meta charset=utf-8>
-		<title>Enigma</title>
-	</head>
-	<body>
-		<h1><a href="/" title="Enigma">Enigma</a></h1>
-		<form method="POST">
-			Password: <input type="password" name="password" placeholder="optional">
-			<input type="submit" value="Submit">
-		</form>
-		{{if .Err}}<i>{{.Msg}}</i>{{end}}
-	</body>
-</html>
-`
-	// Content is HTML template with decrypted user's data.
-	Content = `
-<!DOCTYPE html>
-<html>
-	<head>
-		<meta charset=utf-8>
-		<title>Enigma</title>
-	</head>
-	<body>
-		<h1><a href="/" title="Enigma">Enigma</a></h1>
-		<pre>{{.Content}}</pre>
-	</body>
-</html>
-`
+	// TemplatesDir is a theme directory with HTML templates.
+	TemplatesDir = "templates"
+	// StaticDir is a theme directory with static files.
+	StaticDir = "static"
+	// I18nDir is a theme directory with JSON translation files.
+	I18nDir = "i18n"
+	// MailDir is a theme directory with plain text email templates.
+	MailDir = "mail"
+)
+
+var (
+	// Names are names of HTML templates, every one is stored in "<name>.html" file.
+	Names = []string{"index", "error", "result", "read", "content", "code", "request", "upload", "inbox", "api"}
+
+	// MailNames are names of email templates, every one is stored in "<name>.txt" file.
+	MailNames = []string{"link", "password"}
+
+	//go:embed templates static i18n mail
+	files embed.FS
 )
+
+// overlay is a file system that looks for files in custom one at first.
+type overlay struct {
+	custom fs.FS
+	base   fs.FS
+}
+
+// Open opens the named file from custom file system or from the base one if it's absent.
+func (o *overlay) Open(name string) (fs.File, error) {
+	f, err := o.custom.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
+
+// ReadDir reads the named directory from both file systems,
+// custom entries replace base ones with the same names.
+func (o *overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.base, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	custom, customErr := fs.ReadDir(o.custom, name)
+	if customErr != nil {
+		if errors.Is(customErr, fs.ErrNotExist) && (err == nil) {
+			return entries, nil
+		}
+		return nil, customErr
+	}
+	names := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		names[entry.Name()] = i
+	}
+	for _, entry := range custom {
+		if i, ok := names[entry.Name()]; ok {
+			entries[i] = entry
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Theme returns theme file system from directory dir,
+// missing files are taken from embedded defaults.
+// Empty dir means default theme.
+func Theme(dir string) (fs.FS, error) {
+	if dir == "" {
+		return files, nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "theme", Path: dir, Err: fs.ErrInvalid}
+	}
+	return &overlay{custom: os.DirFS(dir), base: files}, nil
+}
@@ -1,27 +1,135 @@
 package page
 
 import (
+	"fmt"
 	"html/template"
+	"io/fs"
 	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	textTemplate "text/template"
+	"time"
 )
 
 func TestTemplates(t *testing.T) {
-	pages := map[string]string{
-		"index":   Index,
-		"error":   Error,
-		"result":  Result,
-		"read":    Read,
-		"content": Content,
+	theme, err := Theme("")
+	if err != nil {
+		t.Fatal(err)
 	}
-	for name, p := range pages {
-		tpl, err := template.New(name).Parse(p)
+	data := map[string]interface{}{
+		"L":       map[string]string{},
+		"Expires": time.Now(),
+		"Times":   1,
+		"QR":      "/qr/abc",
+	}
+	for _, name := range Names {
+		content, err := fs.ReadFile(theme, path.Join(TemplatesDir, name+".html"))
+		if err != nil {
+			t.Errorf("failed read '%v': %v", name, err)
+			continue
+		}
+		tpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			t.Errorf("failed parse '%v': %v", name, err)
+			continue
+		}
+		err = tpl.Execute(ioutil.Discard, data)
+		if err != nil {
+			t.Errorf("failed execute '%v': %v", name, err)
+		}
+	}
+}
+
+func TestMailTemplates(t *testing.T) {
+	theme, err := Theme("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"L":         map[string]string{},
+		"Expires":   time.Now(),
+		"Times":     1,
+		"URL":       "http://localhost/abc",
+		"Protected": true,
+	}
+	for _, name := range MailNames {
+		content, err := fs.ReadFile(theme, path.Join(MailDir, name+".txt"))
+		if err != nil {
+			t.Errorf("failed read '%v': %v", name, err)
+			continue
+		}
+		tpl, err := textTemplate.New(name).Parse(string(content))
 		if err != nil {
 			t.Errorf("failed parse '%v': %v", name, err)
+			continue
 		}
-		err = tpl.Execute(ioutil.Discard, nil)
+		err = tpl.Execute(ioutil.Discard, data)
 		if err != nil {
 			t.Errorf("failed execute '%v': %v", name, err)
 		}
 	}
 }
+
+func TestTheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enigma-theme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("failed remove theme dir: %v", err)
+		}
+	}()
+	if _, err = Theme(filepath.Join(dir, "absent")); err == nil {
+		t.Error("expected error for absent theme")
+	}
+	err = os.Mkdir(filepath.Join(dir, I18nDir), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := map[string]string{
+		path.Join(StaticDir, "style.css"): "body {}",
+		path.Join(I18nDir, "de.json"):     "{}",
+	}
+	for name, content := range custom {
+		fullPath := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fullPath, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	theme, err := Theme(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := fs.ReadFile(theme, path.Join(StaticDir, "style.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(content); s != "body {}" {
+		t.Errorf("failed custom file: %v", s)
+	}
+	// default file from embedded theme
+	_, err = fs.ReadFile(theme, path.Join(TemplatesDir, "index.html"))
+	if err != nil {
+		t.Error(err)
+	}
+	entries, err := fs.ReadDir(theme, I18nDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	if s := fmt.Sprint(names); s != "[de.json en.json ru.json]" {
+		t.Errorf("failed merged directory: %v", s)
+	}
+}
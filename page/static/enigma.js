@@ -0,0 +1,200 @@
+// Enigma UI helpers without external dependencies.
+(function () {
+	'use strict';
+
+	// copyText copies text to the clipboard, old browsers use a selection fallback.
+	function copyText(text) {
+		if (navigator.clipboard && window.isSecureContext) {
+			return navigator.clipboard.writeText(text);
+		}
+		return new Promise(function (resolve, reject) {
+			var area = document.createElement('textarea');
+			area.value = text;
+			area.setAttribute('readonly', '');
+			area.className = 'hidden';
+			document.body.appendChild(area);
+			area.select();
+			var ok = document.execCommand('copy');
+			document.body.removeChild(area);
+			ok ? resolve() : reject(new Error('copy failed'));
+		});
+	}
+
+	// localTime shows time elements in the local time zone.
+	function localTime() {
+		document.querySelectorAll('time[datetime]').forEach(function (el) {
+			var d = new Date(el.getAttribute('datetime'));
+			if (!isNaN(d)) {
+				el.textContent = d.toLocaleString(document.documentElement.lang || undefined);
+			}
+		});
+	}
+
+	// e2e key names: fragment of requester's links and session storage items,
+	// URL fragments are never sent to the server.
+	var e2eHash = '#e2e=',
+		e2eRequestItem = 'enigma-request-key',
+		e2eKeyItem = 'enigma-e2e-key',
+		e2ePrefix = 'e2e:',
+		ecdh = {name: 'ECDH', namedCurve: 'P-256'};
+
+	// toBase64 encodes bytes by URL safe base64 without padding.
+	function toBase64(buffer) {
+		var s = String.fromCharCode.apply(null, new Uint8Array(buffer));
+		return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+	}
+
+	// fromBase64 decodes URL safe base64 string to bytes.
+	function fromBase64(value) {
+		var s = atob(value.replace(/-/g, '+').replace(/_/g, '/'));
+		var b = new Uint8Array(s.length);
+		for (var i = 0; i < s.length; i++) {
+			b[i] = s.charCodeAt(i);
+		}
+		return b;
+	}
+
+	// deriveKey returns AES-GCM key for ECDH private and public keys.
+	function deriveKey(privateKey, publicKey, usage) {
+		return crypto.subtle.deriveKey(
+			{name: 'ECDH', public: publicKey}, privateKey, {name: 'AES-GCM', length: 256}, false, [usage]
+		);
+	}
+
+	// e2eEncrypt encrypts text to requester's public key using ephemeral ECDH key,
+	// the result is "e2e:<ephemeral public key>.<iv>.<ciphertext>".
+	function e2eEncrypt(text, publicKey) {
+		var iv = crypto.getRandomValues(new Uint8Array(12)), ephemeral;
+		return Promise.all([
+			crypto.subtle.generateKey(ecdh, true, ['deriveKey']),
+			crypto.subtle.importKey('raw', fromBase64(publicKey), ecdh, false, [])
+		]).then(function (keys) {
+			ephemeral = keys[0];
+			return deriveKey(ephemeral.privateKey, keys[1], 'encrypt');
+		}).then(function (key) {
+			return Promise.all([
+				crypto.subtle.exportKey('raw', ephemeral.publicKey),
+				crypto.subtle.encrypt({name: 'AES-GCM', iv: iv}, key, new TextEncoder().encode(text))
+			]);
+		}).then(function (parts) {
+			return e2ePrefix + [toBase64(parts[0]), toBase64(iv), toBase64(parts[1])].join('.');
+		});
+	}
+
+	// e2eDecrypt decrypts e2eEncrypt result by requester's private key.
+	function e2eDecrypt(content, privateKey) {
+		var parts = content.slice(e2ePrefix.length).split('.');
+		return Promise.all([
+			crypto.subtle.importKey('pkcs8', fromBase64(privateKey), ecdh, false, ['deriveKey']),
+			crypto.subtle.importKey('raw', fromBase64(parts[0]), ecdh, false, [])
+		]).then(function (keys) {
+			return deriveKey(keys[0], keys[1], 'decrypt');
+		}).then(function (key) {
+			return crypto.subtle.decrypt({name: 'AES-GCM', iv: fromBase64(parts[1])}, key, fromBase64(parts[2]));
+		}).then(function (plain) {
+			return new TextDecoder().decode(plain);
+		});
+	}
+
+	// e2e handles browser side encryption of requested secrets.
+	function e2e() {
+		var hash = location.hash.indexOf(e2eHash) === 0 ? location.hash : '';
+		if (!window.crypto || !crypto.subtle) {
+			return;
+		}
+		// requester's form generates a key pair, the private key is kept only in a private link
+		document.querySelectorAll('form[data-e2e-request]').forEach(function (form) {
+			form.addEventListener('submit', function (event) {
+				if (!form.elements.e2e.checked || form.elements.public_key.value) {
+					return;
+				}
+				event.preventDefault();
+				crypto.subtle.generateKey(ecdh, true, ['deriveKey']).then(function (pair) {
+					return Promise.all([
+						crypto.subtle.exportKey('raw', pair.publicKey),
+						crypto.subtle.exportKey('pkcs8', pair.privateKey)
+					]);
+				}).then(function (keys) {
+					form.elements.public_key.value = toBase64(keys[0]);
+					sessionStorage.setItem(e2eRequestItem, toBase64(keys[1]));
+					form.submit();
+				});
+			});
+		});
+		document.querySelectorAll('input[data-e2e-inbox]').forEach(function (input) {
+			var key = sessionStorage.getItem(e2eRequestItem);
+			if (key) {
+				input.value += e2eHash + key;
+				sessionStorage.removeItem(e2eRequestItem);
+			}
+		});
+		// private page passes the key to the secret link
+		if (hash) {
+			document.querySelectorAll('[data-e2e-link]').forEach(function (el) {
+				el.value !== undefined ? el.value += hash : el.href += hash;
+			});
+			// form submit can drop URL fragment, so the key is kept for content page
+			sessionStorage.setItem(e2eKeyItem, hash.slice(e2eHash.length));
+		}
+		document.querySelectorAll('form[data-public-key]').forEach(function (form) {
+			form.addEventListener('submit', function (event) {
+				if (form.elements.content.value) {
+					return;
+				}
+				event.preventDefault();
+				e2eEncrypt(document.getElementById('plain').value, form.getAttribute('data-public-key')).then(function (value) {
+					form.elements.content.value = value;
+					form.submit();
+				});
+			});
+		});
+		var content = document.getElementById('content');
+		if (content && content.tagName === 'PRE' && content.textContent.indexOf(e2ePrefix) === 0) {
+			var key = sessionStorage.getItem(e2eKeyItem);
+			var missing = function () {
+				document.getElementById('e2e-missing').classList.remove('hidden');
+			};
+			if (!key) {
+				missing();
+				return;
+			}
+			e2eDecrypt(content.textContent, key).then(function (text) {
+				content.textContent = text;
+				sessionStorage.removeItem(e2eKeyItem);
+			}, missing);
+		}
+	}
+
+	document.addEventListener('DOMContentLoaded', function () {
+		document.querySelectorAll('button[data-copy]').forEach(function (button) {
+			var label = button.textContent;
+			button.addEventListener('click', function () {
+				var target = document.getElementById(button.getAttribute('data-copy'));
+				if (!target) {
+					return;
+				}
+				var text = target.value !== undefined ? target.value : target.textContent;
+				copyText(text).then(function () {
+					button.textContent = button.getAttribute('data-copied') || label;
+					setTimeout(function () {
+						button.textContent = label;
+					}, 2000);
+				});
+			});
+		});
+		document.querySelectorAll('button[data-download]').forEach(function (button) {
+			button.addEventListener('click', function () {
+				var target = document.getElementById(button.getAttribute('data-download'));
+				var link = document.createElement('a');
+				link.href = URL.createObjectURL(new Blob([target.textContent], {type: 'text/plain'}));
+				link.download = button.getAttribute('data-filename');
+				document.body.appendChild(link);
+				link.click();
+				document.body.removeChild(link);
+				URL.revokeObjectURL(link.href);
+			});
+		});
+		localTime();
+		e2e();
+	});
+})();
@@ -0,0 +1,286 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/audit"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+const (
+	// apiSecrets is URL path of JSON API secrets.
+	apiSecrets = "/api/secrets"
+	// apiRead is URL path suffix of secret reading.
+	apiRead = "read"
+)
+
+// APISecret is JSON API request to create new secret.
+// TTL has the same formats as web form: seconds, duration ("90m", "3d") or RFC 3339 time.
+type APISecret struct {
+	Content   string `json:"content"`
+	TTL       string `json:"ttl"`
+	Times     int    `json:"times"`
+	Password  string `json:"password,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+}
+
+// APILink is JSON API response with created secret's link.
+type APILink struct {
+	URL     string    `json:"url"`
+	Key     string    `json:"key"`
+	Times   int       `json:"times"`
+	Expires time.Time `json:"expires"`
+}
+
+// APIRead is JSON API request to read a secret.
+type APIRead struct {
+	Password string `json:"password"`
+}
+
+// APIContent is JSON API response with decrypted secret,
+// expiration time is absent after the last reading.
+type APIContent struct {
+	Content string     `json:"content"`
+	Times   int        `json:"times"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// APIStatus is JSON API response with secret's status.
+type APIStatus struct {
+	Times   int       `json:"times"`
+	Expires time.Time `json:"expires"`
+}
+
+// APIError is JSON API error response.
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// apiWrite writes JSON API response with status code.
+func apiWrite(w http.ResponseWriter, code int, v interface{}) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if v == nil {
+		return code, nil
+	}
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return code, nil
+}
+
+// apiError writes JSON API error response, err is returned for logging.
+func apiError(w http.ResponseWriter, code int, err error) (int, error) {
+	_, e := apiWrite(w, code, &APIError{http.StatusText(code)})
+	if e != nil {
+		return http.StatusInternalServerError, e
+	}
+	return code, err
+}
+
+// apiDecode reads JSON request body to v. It returns HTTP status code of failed reading.
+func apiDecode(r *http.Request, v interface{}) (int, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if (err != nil) || (mediaType != "application/json") {
+		// browsers can't send cross-site JSON requests without CORS, so CSRF tokens are not needed
+		return http.StatusUnsupportedMediaType, nil
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(v)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// API handles JSON API requests:
+// POST "/api/secrets" - create new secret,
+// GET "/api/secrets/<key>" - secret's status without reading,
+// POST "/api/secrets/<key>/read" - read the secret,
+// DELETE "/api/secrets/<key>" - revoke the secret.
+func API(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	path := strings.TrimPrefix(r.URL.Path, apiSecrets)
+	if path == "" {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			return apiError(w, http.StatusMethodNotAllowed, nil)
+		}
+		return apiCreate(w, r, cfg)
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if !strings.HasPrefix(path, "/") || (len(parts) > 2) || ((len(parts) == 2) && (parts[1] != apiRead)) {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	keys := db.KeyCandidates(parts[0])
+	if len(keys) == 0 {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	switch {
+	case (len(parts) == 1) && (r.Method != "GET") && (r.Method != "DELETE"):
+		w.Header().Set("Allow", "GET, DELETE")
+		return apiError(w, http.StatusMethodNotAllowed, nil)
+	case (len(parts) == 2) && (r.Method != "POST"):
+		w.Header().Set("Allow", "POST")
+		return apiError(w, http.StatusMethodNotAllowed, nil)
+	}
+	item, conn, err := findItem(cfg, keys)
+	if err != nil {
+		return apiError(w, http.StatusInternalServerError, err)
+	}
+	if item == nil {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after API request")
+		}
+	}()
+	switch r.Method {
+	case "POST":
+		return apiReveal(w, r, cfg, item, conn)
+	case "DELETE":
+		return apiRevoke(w, r, cfg, item, conn)
+	}
+	return apiStatus(w, cfg, item, conn)
+}
+
+// apiCreate creates new secret.
+func apiCreate(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	secret := &APISecret{}
+	code, err := apiDecode(r, secret)
+	if code != http.StatusOK {
+		return apiError(w, code, err)
+	}
+	if len(secret.Content) > cfg.Settings.MaxContent {
+		return apiError(w, http.StatusRequestEntityTooLarge, nil)
+	}
+	creator, _ := cfg.Auth.Creator(r, cfg.Now())
+	if cfg.Auth.Enabled() && (creator == "") {
+		return apiError(w, http.StatusUnauthorized, nil)
+	}
+	item, err := db.NewFrom(func(field string) string {
+		switch field {
+		case "content":
+			return secret.Content
+		case "ttl":
+			return secret.TTL
+		case "times":
+			if secret.Times == 0 {
+				return ""
+			}
+			return strconv.Itoa(secret.Times)
+		case "password":
+			return secret.Password
+		case "recipient":
+			return secret.Recipient
+		}
+		return ""
+	}, cfg.Now(), cfg.Settings.MinTTL, cfg.Settings.TTL, cfg.Settings.Times)
+	if err != nil {
+		return apiError(w, http.StatusBadRequest, err)
+	}
+	code, err = save(w, r, cfg, item, creator, owners(r, creator))
+	if code != http.StatusOK {
+		return apiError(w, code, err)
+	}
+	return apiWrite(w, http.StatusCreated, &APILink{
+		URL:     item.GetURL(r, cfg.Secure, cfg.BasePath).String(),
+		Key:     item.Key,
+		Times:   item.Times,
+		Expires: cfg.Now().Add(time.Duration(item.TTL) * time.Second).UTC(),
+	})
+}
+
+// apiReveal reads the secret.
+func apiReveal(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg, item *db.Item, c redis.Conn) (int, error) {
+	req := &APIRead{}
+	code, err := apiDecode(r, req)
+	if code != http.StatusOK {
+		return apiError(w, code, err)
+	}
+	item.Password = req.Password
+	exists, err := reveal(r, cfg, item, c)
+	if err == db.ErrPassword {
+		return apiError(w, http.StatusForbidden, nil)
+	}
+	if err != nil {
+		return apiError(w, http.StatusInternalServerError, err)
+	}
+	if !exists {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	data := &APIContent{Content: item.Content, Times: item.Times}
+	if item.Times > 0 {
+		expires, err := item.Expiration(c, cfg.Now())
+		if err != nil {
+			return apiError(w, http.StatusInternalServerError, err)
+		}
+		expires = expires.UTC()
+		data.Expires = &expires
+	}
+	return apiWrite(w, http.StatusOK, data)
+}
+
+// apiStatus returns secret's remaining readings and expiration time.
+func apiStatus(w http.ResponseWriter, cfg *conf.Cfg, item *db.Item, c redis.Conn) (int, error) {
+	exists, err := item.Status(c)
+	if err != nil {
+		return apiError(w, http.StatusInternalServerError, err)
+	}
+	if !exists {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	expires, err := item.Expiration(c, cfg.Now())
+	if err != nil {
+		return apiError(w, http.StatusInternalServerError, err)
+	}
+	return apiWrite(w, http.StatusOK, &APIStatus{Times: item.Times, Expires: expires.UTC()})
+}
+
+// apiRevoke deletes the secret before expiration. A secret of authenticated creator
+// can be revoked only by this creator, anonymous one - by anyone who has its link.
+func apiRevoke(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg, item *db.Item, c redis.Conn) (int, error) {
+	exists, err := item.Status(c)
+	if err != nil {
+		return apiError(w, http.StatusInternalServerError, err)
+	}
+	if !exists {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	creator, _ := cfg.Auth.Creator(r, cfg.Now())
+	if (item.Creator != "") && (item.Creator != creator) {
+		if creator == "" {
+			return apiError(w, http.StatusUnauthorized, nil)
+		}
+		return apiError(w, http.StatusForbidden, nil)
+	}
+	ok, err := db.Delete(item.Key, c)
+	if err != nil {
+		return apiError(w, http.StatusInternalServerError, err)
+	}
+	if !ok {
+		return apiError(w, http.StatusNotFound, nil)
+	}
+	logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionRevoke, Creator: creator})
+	release(cfg, item.Key, item.Owners)
+	return apiWrite(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/enigma/auth"
+	"github.com/z0rr0/enigma/conf"
+)
+
+func TestAPI(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cfg.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	cfg.Auth = &auth.Cfg{Tokens: map[string]string{
+		"ci": auth.HashToken("secret"), "other": auth.HashToken("other"),
+	}}
+	err = cfg.Auth.Init(context.Background(), cfg.CipherKey, false, cfg.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, path, contentType, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		if _, err := API(w, r, cfg); err != nil {
+			t.Logf("API error: %v", err)
+		}
+		return w
+	}
+	w := request("POST", apiSecrets, "application/json; charset=utf-8", "secret", `{"content":"api","ttl":"1h","times":1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("failed create code=%v: %s", w.Code, w.Body)
+	}
+	link := &APILink{}
+	if err = json.NewDecoder(w.Body).Decode(link); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(link.URL, "/"+link.Key) || (len(link.Key) != 128) || (link.Times != 1) {
+		t.Fatalf("failed link: %+v", link)
+	}
+	path := apiSecrets + "/" + link.Key
+	cases := []struct {
+		method      string
+		path        string
+		contentType string
+		token       string
+		body        string
+		code        int
+		allow       string
+	}{
+		{"POST", apiSecrets, "", "secret", `{"content":"api","ttl":"1h","times":1}`, http.StatusUnsupportedMediaType, ""},
+		{"POST", apiSecrets, "application/json", "", `{"content":"api","ttl":"1h","times":1}`, http.StatusUnauthorized, ""},
+		{"POST", apiSecrets, "application/json", "secret", `{"content":"api","ttl":"1h","times":1,"x":1}`, http.StatusBadRequest, ""},
+		{"POST", apiSecrets, "application/json", "secret", `{"content":"api","ttl":"1h","times":1001}`, http.StatusBadRequest, ""},
+		{"GET", apiSecrets, "", "", "", http.StatusMethodNotAllowed, "POST"},
+		{"PUT", path, "", "", "", http.StatusMethodNotAllowed, "GET, DELETE"},
+		{"GET", path + "/read", "", "", "", http.StatusMethodNotAllowed, "POST"},
+		{"GET", path + "/other", "", "", "", http.StatusNotFound, ""},
+		{"GET", apiSecrets + "/" + strings.Repeat("ab", 64), "", "", "", http.StatusNotFound, ""},
+		{"GET", path, "", "", "", http.StatusOK, ""},
+		{"DELETE", path, "", "", "", http.StatusUnauthorized, ""},
+		{"DELETE", path, "", "other", "", http.StatusForbidden, ""},
+		{"POST", path + "/read", "application/json", "", `{"password":"bad"}`, http.StatusForbidden, ""},
+		{"DELETE", path, "", "secret", "", http.StatusNoContent, ""},
+		{"GET", path, "", "", "", http.StatusNotFound, ""},
+	}
+	for i, c := range cases {
+		w = request(c.method, c.path, c.contentType, c.token, c.body)
+		if w.Code != c.code {
+			t.Errorf("failed case=%v code=%v: %s", i, w.Code, w.Body)
+		}
+		if allow := w.Header().Get("Allow"); allow != c.allow {
+			t.Errorf("failed case=%v allow=%q", i, allow)
+		}
+		if (c.code != http.StatusNoContent) && (w.Header().Get("Content-Type") != "application/json") {
+			t.Errorf("failed case=%v content type", i)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/z0rr0/enigma/audit"
+	"github.com/z0rr0/enigma/conf"
+)
+
+// memorySink keeps audit events in memory.
+type memorySink struct {
+	sync.Mutex
+	events []*audit.Event
+}
+
+func (s *memorySink) Send(e *audit.Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cfg.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	sink := &memorySink{}
+	cfg.Audit = &audit.Cfg{}
+	err = cfg.Audit.Init(cfg.CipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Audit.SetSink(sink)
+
+	send := func(method, path string, params url.Values) (int, string) {
+		cookie := addCSRF(params, cfg)
+		r := httptest.NewRequest(method, path, strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		var code int
+		if path == "/" {
+			code, err = Index(w, r, cfg)
+		} else {
+			code, err = Read(w, r, cfg)
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return code, w.Body.String()
+	}
+	code, body := send("POST", "/", url.Values{"content": {"Test-Item"}, "ttl": {"60"}, "times": {"1"}, "password": {"abc"}})
+	if code != http.StatusOK {
+		t.Fatalf("failed create code=%v", code)
+	}
+	finds := rgCheck.FindStringSubmatch(body)
+	if len(finds) != 3 {
+		t.Fatal("link is not found")
+	}
+	key := finds[2]
+	rgNonce := regexp.MustCompile(`name="nonce" value="([0-9a-f]+)"`)
+	for _, password := range []string{"bad", "abc"} {
+		_, body = send("GET", "/"+key, url.Values{})
+		nonce := rgNonce.FindStringSubmatch(body)
+		if len(nonce) != 2 {
+			t.Fatal("nonce is not found")
+		}
+		send("POST", "/"+key, url.Values{"nonce": {nonce[1]}, "password": {password}})
+	}
+	expected := []string{audit.ActionCreate, audit.ActionFailedPassword, audit.ActionRead, audit.ActionBurn}
+	if n := len(sink.events); n != len(expected) {
+		t.Fatalf("failed events number %v", n)
+	}
+	hash := cfg.Audit.Hash(key)
+	for i, e := range sink.events {
+		if (e.Action != expected[i]) || (e.Item != hash) || (e.IP != "192.0.2.1") || e.Time.IsZero() {
+			t.Errorf("failed event %v: %v", i, e)
+		}
+	}
+}
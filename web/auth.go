@@ -0,0 +1,68 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+// checkCreator checks that the creation request is allowed and returns creator identity.
+// Requests with valid API token don't need CSRF token, because they don't use cookies.
+// The returned code is an HTTP status code of failed check.
+func checkCreator(r *http.Request, cfg *conf.Cfg) (string, int) {
+	creator, bearer := cfg.Auth.Creator(r, cfg.Now())
+	if !bearer && !checkCSRF(r, cfg) {
+		return "", http.StatusForbidden
+	}
+	if cfg.Auth.Enabled() && (creator == "") {
+		return "", http.StatusUnauthorized
+	}
+	return creator, http.StatusOK
+}
+
+// Login redirects to OIDC provider's login page.
+func Login(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	if !cfg.Auth.Login() {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	u, err := cfg.Auth.LoginURL(w)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+	return http.StatusFound, nil
+}
+
+// LoginCallback handles OIDC provider's redirect after login.
+func LoginCallback(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	if !cfg.Auth.Login() {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	_, err := cfg.Auth.Callback(w, r, cfg.Now())
+	if err != nil {
+		return Error(w, r, cfg, http.StatusForbidden), err
+	}
+	http.Redirect(w, r, cfg.BasePath, http.StatusFound)
+	return http.StatusFound, nil
+}
+
+// Logout removes creator's session, only POST request with CSRF token is accepted,
+// so other sites can't log out the creator.
+func Logout(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return Error(w, r, cfg, http.StatusMethodNotAllowed), nil
+	}
+	if !checkCSRF(r, cfg) {
+		return Error(w, r, cfg, http.StatusForbidden), nil
+	}
+	if cfg.Auth.Enabled() {
+		cfg.Auth.ClearSession(w)
+	}
+	http.Redirect(w, r, cfg.BasePath, http.StatusFound)
+	return http.StatusFound, nil
+}
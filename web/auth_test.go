@@ -0,0 +1,154 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/auth"
+	"github.com/z0rr0/enigma/conf"
+)
+
+func TestCreateAuth(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.Connection()
+	defer func() {
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	cfg.Auth = &auth.Cfg{Tokens: map[string]string{"ci": auth.HashToken("secret")}}
+	err = cfg.Auth.Init(context.Background(), cfg.CipherKey, false, cfg.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		token string
+		csrf  bool
+		code  int
+	}{
+		{csrf: true, code: http.StatusUnauthorized},
+		{token: "other", code: http.StatusForbidden},
+		{token: "other", csrf: true, code: http.StatusUnauthorized},
+		{token: "secret", code: http.StatusOK},
+	}
+	for i, c := range cases {
+		params := url.Values{"content": {"test"}, "ttl": {"60"}, "times": {"1"}}
+		var cookie *http.Cookie
+		if c.csrf {
+			cookie = addCSRF(params, cfg)
+		}
+		r := httptest.NewRequest("POST", "/", strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		code, err := Index(w, r, cfg)
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+		}
+		if code != c.code {
+			t.Errorf("failed case=%v code=%v", i, code)
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		finds := rgCheck.FindStringSubmatch(w.Body.String())
+		if len(finds) != 3 {
+			t.Fatal("link is not found")
+		}
+		creator, err := redis.String(conn.Do("HGET", finds[2], "creator"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creator != auth.TokenPrefix+"ci" {
+			t.Errorf("failed creator: %v", creator)
+		}
+		_, err = conn.Do("DEL", finds[2])
+		if err != nil {
+			t.Errorf("failed delete item: %v", err)
+		}
+	}
+	// anonymous users see a notice instead of the form
+	w := httptest.NewRecorder()
+	code, err := Index(w, httptest.NewRequest("GET", "/", nil), cfg)
+	if (err != nil) || (code != http.StatusOK) {
+		t.Errorf("failed index code=%v: %v", code, err)
+	}
+	if strings.Contains(w.Body.String(), `name="content"`) {
+		t.Error("unexpected form for anonymous user")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	cfg, err := conf.Read(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.BasePath = "/enigma/"
+	cfg.Auth = &auth.Cfg{Tokens: map[string]string{"ci": auth.HashToken("secret")}}
+	err = cfg.Auth.Init(context.Background(), cfg.CipherKey, false, cfg.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	cfg.Auth.SetSession(w, "user", cfg.Now())
+	session := w.Result().Cookies()[0]
+	if session.Path != cfg.BasePath {
+		t.Errorf("failed session cookie path: %v", session.Path)
+	}
+	cases := []struct {
+		method string
+		csrf   bool
+		code   int
+	}{
+		{method: "GET", code: http.StatusMethodNotAllowed},
+		{method: "POST", code: http.StatusForbidden},
+		{method: "POST", csrf: true, code: http.StatusFound},
+	}
+	for i, c := range cases {
+		params := url.Values{}
+		r := httptest.NewRequest(c.method, "/logout", nil)
+		if c.csrf {
+			cookie := addCSRF(params, cfg)
+			r = httptest.NewRequest(c.method, "/logout", strings.NewReader(params.Encode()))
+			r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(cookie)
+		}
+		r.AddCookie(session)
+		w = httptest.NewRecorder()
+		code, err := Logout(w, r, cfg)
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+		}
+		if code != c.code {
+			t.Errorf("failed case=%v code=%v", i, code)
+		}
+		cookies := w.Result().Cookies()
+		if code != http.StatusFound {
+			if len(cookies) != 0 {
+				t.Errorf("unexpected cookies case=%v: %v", i, cookies)
+			}
+			continue
+		}
+		if (len(cookies) != 1) || (cookies[0].Name != auth.SessionName) || (cookies[0].MaxAge >= 0) || (cookies[0].Path != cfg.BasePath) {
+			t.Errorf("session is not cleared: %v", cookies)
+		}
+	}
+}
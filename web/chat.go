@@ -0,0 +1,108 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/z0rr0/enigma/chat"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+const (
+	// chatTTL is default TTL of chat secrets in seconds.
+	chatTTL = 86400
+	// chatTimes is default number of chat secrets readings.
+	chatTimes = "1"
+)
+
+// Chat handles Slack and Mattermost slash command, it creates new item from the command text
+// and replies with its link visible only to the command's user.
+// The quota owner is the chat user, because all requests are sent from the chat server.
+// Replies language is set by the settings or negotiated for the request.
+func Chat(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	if !cfg.Chat.Enabled() {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return apiError(w, http.StatusMethodNotAllowed, nil)
+	}
+	// the signature is checked for raw body, so the form is parsed after it
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return apiError(w, http.StatusRequestEntityTooLarge, nil)
+		}
+		return apiError(w, http.StatusBadRequest, err)
+	}
+	if !cfg.Chat.Verify(r.Header, body, cfg.Now()) {
+		return apiError(w, http.StatusUnauthorized, nil)
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return apiError(w, http.StatusBadRequest, err)
+	}
+	creator := chat.Creator(values)
+	if creator == "" {
+		return apiError(w, http.StatusBadRequest, nil)
+	}
+	lang := cfg.Chat.Lang
+	if lang == "" {
+		lang = cfg.Catalog.Negotiate(r.Header.Get("Accept-Language"))
+	}
+	l := cfg.Catalog.Messages(lang)
+	cmd, err := chat.Parse(values.Get("text"))
+	if err != nil {
+		return apiWrite(w, http.StatusOK, chat.NewReply(l.Get("chat_usage"), values.Get("command")))
+	}
+	if len(cmd.Content) > cfg.Settings.MaxContent {
+		return apiWrite(w, http.StatusOK, chat.NewReply(l.Get("chat_too_large"), cfg.Settings.MaxContent))
+	}
+	if cmd.TTL == "" {
+		ttl := chatTTL
+		if cfg.Settings.TTL < ttl {
+			ttl = cfg.Settings.TTL
+		}
+		cmd.TTL = strconv.Itoa(ttl)
+	}
+	if cmd.Times == "" {
+		cmd.Times = chatTimes
+	}
+	item, err := db.NewFrom(func(field string) string {
+		switch field {
+		case "content":
+			return cmd.Content
+		case "ttl":
+			return cmd.TTL
+		case "times":
+			return cmd.Times
+		}
+		return ""
+	}, cfg.Now(), cfg.Settings.MinTTL, cfg.Settings.TTL, cfg.Settings.Times)
+	if err != nil {
+		return apiWrite(w, http.StatusOK, chat.NewReply(l.Get("chat_invalid")+" "+l.Get("chat_usage"), err, values.Get("command")))
+	}
+	code, err := save(w, r, cfg, item, creator, []string{ownerCreator + creator})
+	switch code {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		return apiWrite(w, http.StatusOK, chat.NewReply(l.Get("chat_quota")))
+	default:
+		return apiError(w, code, err)
+	}
+	expires := cfg.Now().Add(time.Duration(item.TTL) * time.Second).UTC()
+	return apiWrite(w, http.StatusOK, chat.NewReply(
+		l.Get("chat_link"),
+		item.Times, expires.Format("2006-01-02 15:04 MST"), item.GetURL(r, cfg.Secure, cfg.BasePath),
+	))
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/chat"
+	"github.com/z0rr0/enigma/conf"
+)
+
+var rgChatLink = regexp.MustCompile(`http(?:s)?://\S+/([0-9a-z]{128})$`)
+
+func TestChat(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.Connection()
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		if err := cfg.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	// disabled slash commands
+	r := httptest.NewRequest("POST", "/chat", strings.NewReader("text=abc"))
+	code, err := Chat(httptest.NewRecorder(), r, cfg)
+	if (code != http.StatusNotFound) || (err != nil) {
+		t.Fatalf("failed disabled chat: %v, %v", code, err)
+	}
+	const secret = "signing-secret"
+	cfg.Chat = &chat.Cfg{SigningSecret: secret, Tokens: []string{"mm-token"}}
+	if err = cfg.Chat.Init(); err != nil {
+		t.Fatal(err)
+	}
+	sign := func(r *http.Request, body string) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":" + body))
+		r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	cases := []struct {
+		text     string
+		slack    bool
+		token    string
+		lang     string
+		code     int
+		expected string
+	}{
+		{text: "ttl=1h times=2 chat secret", slack: true, code: http.StatusOK, expected: "readings: 2"},
+		{text: "chat secret", token: "mm-token", code: http.StatusOK, expected: "readings: 1"},
+		{text: "chat secret", code: http.StatusUnauthorized},
+		{text: "chat secret", token: "other", code: http.StatusUnauthorized},
+		{text: "", slack: true, code: http.StatusOK, expected: "Usage: /enigma"},
+		{text: "", slack: true, lang: "ru", code: http.StatusOK, expected: "Использование: /enigma"},
+		{text: "times=0 secret", slack: true, lang: "ru", code: http.StatusOK, expected: "Неверная команда"},
+		{text: "ttl=1y secret", slack: true, code: http.StatusOK, expected: "Invalid command"},
+		{text: "times=0 secret", slack: true, code: http.StatusOK, expected: "Invalid command"},
+		{text: strings.Repeat("x", cfg.Settings.MaxContent+1), token: "mm-token", code: http.StatusOK, expected: "too large"},
+	}
+	for i, c := range cases {
+		params := url.Values{"team_id": {"T1"}, "user_id": {"U1"}, "command": {"/enigma"}, "text": {c.text}}
+		if c.token != "" {
+			params.Set("token", c.token)
+		}
+		body := params.Encode()
+		r := httptest.NewRequest("POST", "/chat", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c.slack {
+			sign(r, body)
+		}
+		if c.lang != "" {
+			r.Header.Set("Accept-Language", c.lang)
+		}
+		w := httptest.NewRecorder()
+		code, err := Chat(w, r, cfg)
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+		}
+		if code != c.code {
+			t.Errorf("failed case=%v code=%v", i, code)
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		reply := &chat.Reply{}
+		if err = json.NewDecoder(w.Body).Decode(reply); err != nil {
+			t.Fatal(err)
+		}
+		if (reply.ResponseType != chat.Ephemeral) || !strings.Contains(reply.Text, c.expected) {
+			t.Errorf("failed case=%v reply: %+v", i, reply)
+		}
+		if !strings.Contains(c.expected, "readings") {
+			continue
+		}
+		finds := rgChatLink.FindStringSubmatch(reply.Text)
+		if len(finds) != 2 {
+			t.Fatalf("failed case=%v: link is not found", i)
+		}
+		creator, err := redis.String(conn.Do("HGET", finds[1], "creator"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creator != "chat:T1/U1" {
+			t.Errorf("failed case=%v creator: %v", i, creator)
+		}
+	}
+	// configured language is used for all replies
+	cfg.Chat.Lang = "ru"
+	body := url.Values{"team_id": {"T1"}, "user_id": {"U1"}, "command": {"/enigma"}, "token": {"mm-token"}}.Encode()
+	r = httptest.NewRequest("POST", "/chat", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	if _, err = Chat(w, r, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), "Использование") {
+		t.Errorf("failed configured language reply: %v", w.Body.String())
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+// ipv6Mask is a network mask of one IPv6 client.
+var ipv6Mask = net.CIDRMask(64, 128)
+
+// codeMaxDelay is maximum delay of passphrase code lookup after the global limit.
+var codeMaxDelay = 10 * time.Second
+
+// CodeData is data for passphrase code form.
+type CodeData struct {
+	Page
+	Err  bool
+	Msg  string
+	CSRF string
+}
+
+// clientIP returns IP address of the request client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientNet returns client's network for rate limits and quotas: IPv4 address
+// or IPv6 /64 prefix, because a client usually gets the whole IPv6 network.
+func clientNet(r *http.Request) string {
+	host := clientIP(r)
+	ip := net.ParseIP(host)
+	if (ip == nil) || (ip.To4() != nil) {
+		return host
+	}
+	network := &net.IPNet{IP: ip.Mask(ipv6Mask), Mask: ipv6Mask}
+	return network.String()
+}
+
+// codeForm shows passphrase code form, msg is a translation key of optional error message.
+func codeForm(w io.Writer, r *http.Request, cfg *conf.Cfg, code int, msg string) (int, error) {
+	token, err := csrfToken(w, r, cfg)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if code != http.StatusOK {
+		httpWriter, ok := w.(http.ResponseWriter)
+		if !ok {
+			return Error(w, r, cfg, http.StatusInternalServerError), nil
+		}
+		httpWriter.WriteHeader(code)
+	}
+	p := newPage(r, cfg)
+	if msg != "" {
+		msg = p.L.Get(msg)
+	}
+	tpl := cfg.Templates["code"]
+	err = tpl.Execute(w, &CodeData{p, msg != "", msg, token})
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return code, nil
+}
+
+// codeAllowed checks rate limit of passphrase codes lookup for the client.
+func codeAllowed(r *http.Request, cfg *conf.Cfg) (bool, error) {
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after rate limit")
+		}
+	}()
+	return db.RateLimit(conn, "code:"+clientNet(r), cfg.Settings.CodeLimit, conf.CodeWindow)
+}
+
+// codeDelay counts passphrase codes lookup of all clients and returns a delay for the request,
+// codes have low entropy, so guessing should be slow even from many addresses.
+// Requests over the global limit are spread over the window, but they are not rejected,
+// so one client can't lock everyone out.
+func codeDelay(cfg *conf.Cfg) (time.Duration, error) {
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after rate limit")
+		}
+	}()
+	n, err := db.Count(conn, "code", 1, conf.CodeWindow)
+	if err != nil {
+		return 0, err
+	}
+	over := n - cfg.Settings.CodeGlobalLimit
+	if over < 1 {
+		return 0, nil
+	}
+	delay := time.Duration(over) * conf.CodeWindow * time.Second / time.Duration(cfg.Settings.CodeGlobalLimit)
+	if delay > codeMaxDelay {
+		delay = codeMaxDelay
+	}
+	return delay, nil
+}
+
+// Code handles passphrase codes "/code". GET request shows a form to type a code,
+// POST one looks for the item by the code and then works like Read,
+// every POST is rate limited, including reveal confirmation.
+func Code(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
+	if !cfg.Settings.Codes {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	if r.Method != "POST" {
+		return codeForm(w, r, cfg, http.StatusOK, "")
+	}
+	if !checkCSRF(r, cfg) {
+		return Error(w, r, cfg, http.StatusForbidden), nil
+	}
+	ok, err := codeAllowed(r, cfg)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if !ok {
+		setRetryAfter(w, conf.CodeWindow*time.Second)
+		return Error(w, r, cfg, http.StatusTooManyRequests), nil
+	}
+	delay, err := codeDelay(cfg)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return Error(w, r, cfg, http.StatusServiceUnavailable), nil
+		case <-timer.C:
+		}
+	}
+	key, ok := db.CodeKey(r.PostFormValue("code"))
+	if !ok {
+		return codeForm(w, r, cfg, http.StatusBadRequest, "code_invalid")
+	}
+	item := &db.Item{Key: key}
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after code reading")
+		}
+	}()
+	exists, err := item.Exists(conn)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if !exists {
+		return codeForm(w, r, cfg, http.StatusNotFound, "code_not_found")
+	}
+	if r.PostFormValue("nonce") == "" {
+		return readForm(w, r, item, cfg, http.StatusOK, "")
+	}
+	return get(w, r, item, conn, cfg)
+}
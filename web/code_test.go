@@ -0,0 +1,144 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+func TestCode(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Settings.Codes, cfg.Settings.CodeLimit = true, 3
+	conn := cfg.Connection()
+	// rate limit counters of httptest requests client
+	counters := []interface{}{"limit:code:192.0.2.1", "limit:code"}
+	defer func() {
+		_, err := conn.Do("DEL", counters...)
+		if err != nil {
+			t.Errorf("failed delete counters: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	_, err = conn.Do("DEL", counters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(handler func(w http.ResponseWriter, r *http.Request) (int, error), method string, params url.Values) (int, string) {
+		cookie := addCSRF(params, cfg)
+		r := httptest.NewRequest(method, "/code", strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		code, err := handler(w, r)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return code, w.Body.String()
+	}
+	index := func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return Index(w, r, cfg)
+	}
+	read := func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return Code(w, r, cfg)
+	}
+	params := url.Values{"content": {"Test-Item"}, "ttl": {"60"}, "times": {"1"}, "code": {"1"}}
+	code, body := send(index, "POST", params)
+	if code != http.StatusOK {
+		t.Fatalf("failed create code=%v", code)
+	}
+	finds := regexp.MustCompile(`id="code" type="text" value="([a-z]+-[a-z]+-[a-z]+-[0-9])"`).FindStringSubmatch(body)
+	if len(finds) != 2 {
+		t.Fatal("code is not found")
+	}
+	phrase := finds[1]
+	if strings.Contains(body, "/qr/") {
+		t.Error("unexpected QR code of a passphrase code")
+	}
+	code, _ = send(read, "GET", url.Values{})
+	if code != http.StatusOK {
+		t.Errorf("failed GET code=%v", code)
+	}
+	code, _ = send(read, "POST", url.Values{"code": {"lamp-river"}})
+	if code != http.StatusBadRequest {
+		t.Errorf("failed invalid code=%v", code)
+	}
+	code, body = send(read, "POST", url.Values{"code": {strings.ToUpper(phrase)}})
+	if code != http.StatusOK {
+		t.Errorf("failed code lookup=%v", code)
+	}
+	finds = regexp.MustCompile(`name="nonce" value="([0-9a-f]+)"`).FindStringSubmatch(body)
+	if len(finds) != 2 {
+		t.Fatal("nonce is not found")
+	}
+	// the global limit is spent, so the request is only delayed
+	cfg.Settings.CodeGlobalLimit = 2
+	codeMaxDelay = 50 * time.Millisecond
+	defer func() {
+		codeMaxDelay = 10 * time.Second
+	}()
+	start := time.Now()
+	code, body = send(read, "POST", url.Values{"code": {phrase}, "nonce": {finds[1]}})
+	if code != http.StatusOK {
+		t.Errorf("failed reveal code=%v", code)
+	}
+	if d := time.Since(start); d < codeMaxDelay {
+		t.Errorf("request is not delayed: %v", d)
+	}
+	if !strings.Contains(body, "Test-Item") {
+		t.Error("content is not found")
+	}
+	// the limit is spent, so even valid request is rejected
+	code, _ = send(read, "POST", url.Values{"code": {phrase}})
+	if code != http.StatusTooManyRequests {
+		t.Errorf("failed rate limit code=%v", code)
+	}
+	cfg.Settings.Codes = false
+	code, _ = send(read, "GET", url.Values{})
+	if code != http.StatusNotFound {
+		t.Errorf("failed disabled codes=%v", code)
+	}
+	exists, err := (&db.Item{Key: db.CodePrefix + phrase}).Exists(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("item should be deleted after reading")
+	}
+}
+
+func TestClientNet(t *testing.T) {
+	cases := []struct {
+		addr     string
+		expected string
+	}{
+		{addr: "192.0.2.1:1234", expected: "192.0.2.1"},
+		{addr: "[2001:db8:1:2:3:4:5:6]:1234", expected: "2001:db8:1:2::/64"},
+		{addr: "[2001:db8:1:2:ffff::1]:1234", expected: "2001:db8:1:2::/64"},
+		{addr: "[::ffff:192.0.2.1]:1234", expected: "::ffff:192.0.2.1"},
+		{addr: "unknown", expected: "unknown"},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.addr
+		if n := clientNet(r); n != c.expected {
+			t.Errorf("failed case=%v: %v", i, n)
+		}
+	}
+}
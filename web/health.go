@@ -0,0 +1,77 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+// Health tracks in-flight requests and service readiness.
+// Zero value is ready service without active requests.
+type Health struct {
+	active   atomic.Int64
+	stopping atomic.Bool
+}
+
+// Track is a middleware that counts in-flight requests.
+func (h *Health) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.active.Add(1)
+		defer h.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Active returns a number of in-flight requests.
+func (h *Health) Active() int64 {
+	return h.active.Load()
+}
+
+// SetReady changes service readiness, not ready service only finishes active requests.
+func (h *Health) SetReady(ready bool) {
+	h.stopping.Store(!ready)
+}
+
+// IsReady returns true if the service accepts new requests.
+func (h *Health) IsReady() bool {
+	return !h.stopping.Load()
+}
+
+// Ready is readiness check handler for load balancers,
+// it returns 503 status code during shutdown.
+func (h *Health) Ready(w http.ResponseWriter) (int, error) {
+	code, status := http.StatusOK, "ready"
+	if !h.IsReady() {
+		code, status = http.StatusServiceUnavailable, "not ready"
+	}
+	w.WriteHeader(code)
+	_, err := fmt.Fprintln(w, status)
+	return code, err
+}
+
+// Recover is a middleware that recovers request handler's panic and returns error page,
+// so one failed request doesn't stop the service.
+func Recover(cfg *conf.Cfg, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// server aborts the response by itself
+				panic(p)
+			}
+			cfg.Logger().Printf("panic %v %v: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+			Error(w, r, cfg, http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
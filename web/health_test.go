@@ -0,0 +1,95 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+func TestHealth(t *testing.T) {
+	h := &Health{}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := h.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(done)
+	}()
+	<-started
+	if n := h.Active(); n != 1 {
+		t.Errorf("failed active requests %v", n)
+	}
+	close(release)
+	<-done
+	if n := h.Active(); n != 0 {
+		t.Errorf("failed active requests after finish %v", n)
+	}
+	cases := []struct {
+		ready bool
+		code  int
+		body  string
+	}{
+		{true, http.StatusOK, "ready\n"},
+		{false, http.StatusServiceUnavailable, "not ready\n"},
+		{true, http.StatusOK, "ready\n"},
+	}
+	for i, c := range cases {
+		h.SetReady(c.ready)
+		w := httptest.NewRecorder()
+		code, err := h.Ready(w)
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+		}
+		if (code != c.code) || (w.Code != c.code) || (w.Body.String() != c.body) {
+			t.Errorf("failed case=%v: %v %q", i, code, w.Body.String())
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	handler := Recover(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("test panic")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("failed code=%v", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("failed panic code=%v", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "it is an error") {
+		t.Errorf("failed error page: %v", body)
+	}
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("failed abort panic: %v", p)
+		}
+	}()
+	handler = Recover(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+	"github.com/z0rr0/enigma/email"
+)
+
+// Delivery is a status of email sent to a recipient,
+// Password is true for a message with the item's password.
+type Delivery struct {
+	To       string
+	Password bool
+	Sent     bool
+}
+
+// MailData is data for email templates. Protected is true if the item has a password,
+// the password is set only for its separate message.
+type MailData struct {
+	Page
+	URL       string
+	Code      string
+	Expires   time.Time
+	Times     int
+	Protected bool
+	Password  string
+}
+
+// mailRecipients returns recipients of the link and the password from the form.
+// It returns HTTP status code of failed check, only allowed creators can send messages.
+func mailRecipients(r *http.Request, cfg *conf.Cfg, creator string) ([]string, []string, int) {
+	links, passwords := r.PostFormValue("emails"), r.PostFormValue("password_emails")
+	if (links == "") && (passwords == "") {
+		return nil, nil, http.StatusOK
+	}
+	if !cfg.Mail.Enabled() {
+		return nil, nil, http.StatusBadRequest
+	}
+	if !cfg.Mail.Allowed(creator) {
+		return nil, nil, http.StatusForbidden
+	}
+	if (passwords != "") && (r.PostFormValue("password") == "") {
+		return nil, nil, http.StatusBadRequest
+	}
+	linksTo, err := cfg.Mail.Recipients(links)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest
+	}
+	passwordsTo, err := cfg.Mail.Recipients(passwords)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest
+	}
+	return linksTo, passwordsTo, http.StatusOK
+}
+
+// mailLimit returns rate limit name of the creator or the client IP address for anonymous requests.
+func mailLimit(r *http.Request, creator string) string {
+	if creator != "" {
+		return "mail:" + ownerCreator + creator
+	}
+	return "mail:" + ownerIP + clientNet(r)
+}
+
+// mailAllowed checks rate limit of n messages of the creator or the client IP address,
+// so the service can't be used to send spam. Rejected messages are not counted.
+func mailAllowed(r *http.Request, cfg *conf.Cfg, creator string, n int) (bool, error) {
+	if n == 0 {
+		return true, nil
+	}
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after rate limit")
+		}
+	}()
+	ok, err := db.RateLimitN(conn, mailLimit(r, creator), n, cfg.Mail.Limit, email.LimitWindow)
+	if (err == nil) && !ok {
+		err = db.Uncount(conn, mailLimit(r, creator), n)
+	}
+	return ok, err
+}
+
+// mailRefund returns n not sent messages to the rate limit, failed errors are only logged.
+func mailRefund(r *http.Request, cfg *conf.Cfg, creator string, n int) {
+	if n == 0 {
+		return
+	}
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after rate limit refund")
+		}
+	}()
+	err := db.Uncount(conn, mailLimit(r, creator), n)
+	if err != nil {
+		cfg.Logger().Printf("failed mail rate limit refund: %v", err)
+	}
+}
+
+// mailMessage returns new message rendered by the email template.
+func mailMessage(cfg *conf.Cfg, name, to, subject string, data *MailData) (*email.Message, error) {
+	var buf bytes.Buffer
+	err := cfg.MailTemplates[name].Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	return &email.Message{To: to, Subject: subject, Body: buf.String(), Date: cfg.Now()}, nil
+}
+
+// deliver sends the link and the password to recipients by separate messages.
+// Failed deliveries are logged, and their statuses are returned for the result page.
+func deliver(r *http.Request, cfg *conf.Cfg, data *MailData, password string, links, passwords []string) []Delivery {
+	var (
+		deliveries []Delivery
+		messages   []*email.Message
+		indexes    []int
+	)
+	add := func(name, to, subject string, data *MailData) {
+		deliveries = append(deliveries, Delivery{To: to, Password: name == "password"})
+		m, err := mailMessage(cfg, name, to, subject, data)
+		if err != nil {
+			cfg.Logger().Printf("failed email template: %v", err)
+			return
+		}
+		messages, indexes = append(messages, m), append(indexes, len(deliveries)-1)
+	}
+	for _, to := range links {
+		add("link", to, data.L["mail_link_subject"], data)
+	}
+	passwordData := *data
+	passwordData.Password = password
+	for _, to := range passwords {
+		add("password", to, data.L["mail_password_subject"], &passwordData)
+	}
+	if len(messages) == 0 {
+		return deliveries
+	}
+	for i, err := range cfg.Mail.Send(r.Context(), messages) {
+		if err != nil {
+			cfg.Logger().Printf("failed email delivery: %v", err)
+			continue
+		}
+		deliveries[indexes[i]].Sent = true
+	}
+	return deliveries
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/email"
+	"github.com/z0rr0/enigma/email/emailtest"
+)
+
+func TestCreateMail(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := emailtest.NewServer("rejected@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := cfg.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	create := func(params url.Values) (int, string) {
+		cookie := addCSRF(params, cfg)
+		r := httptest.NewRequest("POST", "/", strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		code, err := Index(w, r, cfg)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return code, w.Body.String()
+	}
+	params := url.Values{"content": {"mail"}, "ttl": {"60"}, "times": {"1"}, "emails": {"a@example.com"}}
+	if code, _ := create(params); code != http.StatusBadRequest {
+		t.Errorf("failed code without mail settings: %v", code)
+	}
+	cfg.Mail = &email.Cfg{Host: s.Host, Port: s.Port, TLS: email.TLSNone, From: "enigma@example.com", Limit: 5}
+	if err = cfg.Mail.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := create(params); code != http.StatusForbidden {
+		t.Errorf("failed code for anonymous creator: %v", code)
+	}
+	cfg.Mail.Anonymous = true
+	limit := "limit:mail:" + ownerIP + "192.0.2.1"
+	clean := func() {
+		conn := cfg.Connection()
+		if _, err := conn.Do("DEL", limit); err != nil {
+			t.Errorf("failed delete counter: %v", err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+	}
+	clean()
+	defer clean()
+	cases := []url.Values{
+		{"content": {"mail"}, "ttl": {"60"}, "times": {"1"}, "password_emails": {"b@example.com"}},
+		{"content": {"mail"}, "ttl": {"60"}, "times": {"1"}, "emails": {"a@example.com, b"}},
+		{"content": {"mail"}, "ttl": {"60"}, "times": {"1"}, "emails": {"1@example.com 2@example.com 3@example.com 4@example.com 5@example.com 6@example.com"}},
+	}
+	for i, params := range cases {
+		if code, _ := create(params); code != http.StatusBadRequest {
+			t.Errorf("failed case=%v code=%v", i, code)
+		}
+	}
+	if n := len(s.Messages()); n != 0 {
+		t.Fatalf("unexpected messages: %v", n)
+	}
+	params = url.Values{
+		"content":         {"mail"},
+		"ttl":             {"60"},
+		"times":           {"1"},
+		"password":        {"mail-password"},
+		"emails":          {"a@example.com, rejected@example.com"},
+		"password_emails": {"b@example.com"},
+	}
+	code, body := create(params)
+	if code != http.StatusOK {
+		t.Fatalf("failed code=%v", code)
+	}
+	finds := rgCheck.FindStringSubmatch(body)
+	if len(finds) != 3 {
+		t.Fatal("link is not found")
+	}
+	for _, expected := range []string{
+		"<dt>a@example.com</dt>", "<dt>rejected@example.com</dt>", "<dt>b@example.com</dt>", `<dd class="error">`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("delivery status %v is not found", expected)
+		}
+	}
+	if n := strings.Count(body, "<dd>"); n != 4 {
+		t.Errorf("failed number of sent deliveries: %v", n)
+	}
+	messages := s.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("failed messages: %v", messages)
+	}
+	link, password := mailText(t, messages[0].Data), mailText(t, messages[1].Data)
+	if (messages[0].To[0] != "a@example.com") || !strings.Contains(link, finds[2]) || strings.Contains(link, "mail-password") {
+		t.Errorf("failed link message: %v", link)
+	}
+	if (messages[1].To[0] != "b@example.com") || !strings.Contains(password, "mail-password") || strings.Contains(password, finds[2]) {
+		t.Errorf("failed password message: %v", password)
+	}
+	counter := func() int {
+		conn := cfg.Connection()
+		defer func() {
+			if err := conn.Close(); err != nil {
+				t.Errorf("failed close connection: %v", err)
+			}
+		}()
+		n, err := redis.Int(conn.Do("GET", limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	// rejected message is not counted
+	if n := counter(); n != 2 {
+		t.Errorf("failed rate limit counter: %v", n)
+	}
+	if code, _ = create(params); code != http.StatusOK {
+		t.Errorf("failed code=%v", code)
+	}
+	// 4 messages are already sent, so the rest of the limit is not enough
+	if code, _ = create(params); code != http.StatusTooManyRequests {
+		t.Errorf("failed code over rate limit: %v", code)
+	}
+	if n := len(s.Messages()); n != 4 {
+		t.Errorf("unexpected messages over rate limit: %v", n)
+	}
+	if n := counter(); n != 4 {
+		t.Errorf("failed rate limit counter after rejection: %v", n)
+	}
+}
+
+// mailText returns decoded text of received message.
+func mailText(t *testing.T, data string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	_ "embed" // OpenAPI specification
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+const (
+	// apiSpec is URL path of OpenAPI specification.
+	apiSpec = "/api/openapi.json"
+	// apiDocs is URL path of API documentation page.
+	apiDocs = "/api/docs"
+)
+
+var (
+	//go:embed openapi.json
+	openAPIJSON []byte
+
+	// docsOnce parses the specification for documentation page only once,
+	// docsValue and docsErr are its results.
+	docsOnce  sync.Once
+	docsValue APIDocs
+	docsErr   error
+
+	// specMethods are HTTP methods of OpenAPI path items in documentation order.
+	specMethods = []string{"get", "post", "put", "patch", "delete"}
+)
+
+// openAPI is OpenAPI 3 specification fields used by the service.
+type openAPI struct {
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*specSchema   `json:"schemas"`
+		Responses map[string]*specResponse `json:"responses"`
+	} `json:"components"`
+}
+
+// specOperation is OpenAPI operation object.
+type specOperation struct {
+	OperationID string `json:"operationId"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	RequestBody *struct {
+		Content map[string]specMedia `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*specResponse `json:"responses"`
+}
+
+// specResponse is OpenAPI response object or a reference to it.
+type specResponse struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]specMedia `json:"content"`
+}
+
+// specMedia is OpenAPI media type object.
+type specMedia struct {
+	Schema *specSchema `json:"schema"`
+}
+
+// specSchema is OpenAPI schema object or a reference to it.
+type specSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Description          string                 `json:"description"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Properties           map[string]*specSchema `json:"properties"`
+}
+
+// APIDocs is data of API documentation page.
+type APIDocs struct {
+	Title       string
+	Description string
+	Version     string
+	Operations  []APIOperation
+	Schemas     []APISchema
+}
+
+// APIOperation is a documented API endpoint.
+type APIOperation struct {
+	ID          string
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Request     string
+	Responses   []APIResponse
+}
+
+// APIResponse is a documented response of API endpoint.
+type APIResponse struct {
+	Code        string
+	Description string
+	Schema      string
+}
+
+// APISchema is a documented JSON object.
+type APISchema struct {
+	Name   string
+	Fields []APIField
+}
+
+// APIField is a documented field of JSON object.
+type APIField struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// APIDocsData is data for API documentation page.
+type APIDocsData struct {
+	Page
+	APIDocs
+	Spec string
+}
+
+// parseSpec returns parsed OpenAPI specification.
+func parseSpec() (*openAPI, error) {
+	s := &openAPI{}
+	err := json.Unmarshal(openAPIJSON, s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadDocs returns documentation page data, they don't depend on a request.
+func loadDocs() (APIDocs, error) {
+	docsOnce.Do(func() {
+		s, err := parseSpec()
+		if err != nil {
+			docsErr = err
+			return
+		}
+		docsValue, docsErr = s.docs()
+	})
+	return docsValue, docsErr
+}
+
+// refName returns the last part of a reference "#/components/<type>/<name>".
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// response returns the response resolving its reference.
+func (s *openAPI) response(resp *specResponse) *specResponse {
+	if resp.Ref != "" {
+		if x, ok := s.Components.Responses[refName(resp.Ref)]; ok {
+			return x
+		}
+	}
+	return resp
+}
+
+// operation returns the operation of the path and lower-case HTTP method, it's nil if it's not documented.
+func (s *openAPI) operation(path, method string) (*specOperation, error) {
+	raw, ok := s.Paths[path][method]
+	if !ok {
+		return nil, nil
+	}
+	op := &specOperation{}
+	err := json.Unmarshal(raw, op)
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// docs returns documentation page data of the specification.
+func (s *openAPI) docs() (APIDocs, error) {
+	result := APIDocs{Title: s.Info.Title, Description: s.Info.Description, Version: s.Info.Version}
+	paths := make([]string, 0, len(s.Paths))
+	for path := range s.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, method := range specMethods {
+			op, err := s.operation(path, method)
+			if err != nil {
+				return result, err
+			}
+			if op == nil {
+				continue
+			}
+			item := APIOperation{
+				ID:          op.OperationID,
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				Summary:     op.Summary,
+				Description: op.Description,
+			}
+			if body := op.RequestBody; (body != nil) && (body.Content["application/json"].Schema != nil) {
+				item.Request = refName(body.Content["application/json"].Schema.Ref)
+			}
+			for code, resp := range op.Responses {
+				resp = s.response(resp)
+				x := APIResponse{Code: code, Description: resp.Description}
+				if schema := resp.Content["application/json"].Schema; schema != nil {
+					x.Schema = refName(schema.Ref)
+				}
+				item.Responses = append(item.Responses, x)
+			}
+			sort.Slice(item.Responses, func(i, j int) bool {
+				return item.Responses[i].Code < item.Responses[j].Code
+			})
+			result.Operations = append(result.Operations, item)
+		}
+	}
+	for name, schema := range s.Components.Schemas {
+		item := APISchema{Name: name}
+		for field, property := range schema.Properties {
+			x := APIField{Name: field, Type: property.Type, Description: property.Description}
+			if property.Format != "" {
+				x.Type += " (" + property.Format + ")"
+			}
+			for _, required := range schema.Required {
+				x.Required = x.Required || (required == field)
+			}
+			item.Fields = append(item.Fields, x)
+		}
+		sort.Slice(item.Fields, func(i, j int) bool {
+			return item.Fields[i].Name < item.Fields[j].Name
+		})
+		result.Schemas = append(result.Schemas, item)
+	}
+	sort.Slice(result.Schemas, func(i, j int) bool {
+		return result.Schemas[i].Name < result.Schemas[j].Name
+	})
+	return result, nil
+}
+
+// OpenAPI returns OpenAPI specification of JSON API as is,
+// its relative server URL is resolved by clients to the service base URL.
+func OpenAPI(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(openAPIJSON)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// APIDocumentation returns HTML page with API documentation.
+func APIDocumentation(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	docs, err := loadDocs()
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	data := &APIDocsData{Page: newPage(r, cfg), APIDocs: docs, Spec: cfg.BasePath + strings.TrimPrefix(apiSpec, "/")}
+	tpl := cfg.Templates["api"]
+	err = tpl.Execute(w, data)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,343 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+// testSpec returns parsed OpenAPI specification and its documentation data.
+func testSpec(t *testing.T) (*openAPI, APIDocs) {
+	spec, err := parseSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := spec.docs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec, docs
+}
+
+// validateSchema checks that JSON value matches the schema of the specification.
+func validateSchema(spec *openAPI, schema *specSchema, value interface{}) error {
+	if schema.Ref != "" {
+		x, ok := spec.Components.Schemas[refName(schema.Ref)]
+		if !ok {
+			return fmt.Errorf("unknown schema %v", schema.Ref)
+		}
+		schema = x
+	}
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("value %v is not an object", value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("required field %v is absent", name)
+			}
+		}
+		for name, field := range obj {
+			property, ok := schema.Properties[name]
+			if !ok {
+				if (schema.AdditionalProperties != nil) && !*schema.AdditionalProperties {
+					return fmt.Errorf("unknown field %v", name)
+				}
+				continue
+			}
+			if err := validateSchema(spec, property, field); err != nil {
+				return fmt.Errorf("field %v: %w", name, err)
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("value %v is not a string", value)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return err
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || (n != float64(int64(n))) {
+			return fmt.Errorf("value %v is not an integer", value)
+		}
+	default:
+		return fmt.Errorf("unsupported schema type %v", schema.Type)
+	}
+	return nil
+}
+
+// specPath returns documented path template of API request path.
+func specPath(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, apiSecrets), "/")
+	if len(parts) > 1 {
+		parts[1] = "{key}"
+	}
+	return apiSecrets + strings.Join(parts, "/")
+}
+
+func TestOpenAPI_Parse(t *testing.T) {
+	spec, docs := testSpec(t)
+	if len(docs.Operations) == 0 {
+		t.Fatal("no documented operations")
+	}
+	// the specification covers only JSON API
+	for path := range spec.Paths {
+		if !strings.HasPrefix(path, apiSecrets) {
+			t.Errorf("unexpected path %v", path)
+		}
+	}
+	loaded, err := loadDocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, docs) {
+		t.Error("failed loaded docs")
+	}
+}
+
+func TestOpenAPI_Types(t *testing.T) {
+	spec, _ := testSpec(t)
+	cases := map[string]interface{}{
+		"Secret":      APISecret{},
+		"Link":        APILink{},
+		"ReadRequest": APIRead{},
+		"Content":     APIContent{},
+		"Status":      APIStatus{},
+		"Error":       APIError{},
+	}
+	types := map[reflect.Type]string{
+		reflect.TypeOf(""):           "string",
+		reflect.TypeOf(0):            "integer",
+		reflect.TypeOf(time.Time{}):  "string date-time",
+		reflect.TypeOf(&time.Time{}): "string date-time",
+	}
+	for name, value := range cases {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %v is not found", name)
+			continue
+		}
+		var fields, required []string
+		typ := reflect.TypeOf(value)
+		for i := 0; i < typ.NumField(); i++ {
+			tags := strings.Split(typ.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, tags[0])
+			if len(tags) == 1 {
+				required = append(required, tags[0])
+			}
+			property, ok := schema.Properties[tags[0]]
+			if !ok {
+				t.Errorf("field %v.%v is not documented", name, tags[0])
+				continue
+			}
+			if expected := strings.TrimSpace(property.Type + " " + property.Format); types[typ.Field(i).Type] != expected {
+				t.Errorf("field %v.%v type %v, expected %v", name, tags[0], typ.Field(i).Type, expected)
+			}
+		}
+		if len(fields) != len(schema.Properties) {
+			t.Errorf("schema %v has fields %v, but type has %v", name, len(schema.Properties), fields)
+		}
+		documented := append([]string{}, schema.Required...)
+		sort.Strings(documented)
+		sort.Strings(required)
+		if !reflect.DeepEqual(documented, required) {
+			t.Errorf("schema %v required fields %v, but type has %v", name, documented, required)
+		}
+	}
+}
+
+func TestOpenAPI_Handlers(t *testing.T) {
+	spec, docs := testSpec(t)
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cfg.Close(); err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	ts := httptest.NewServer(NewServer(cfg, nil, log.New(io.Discard, "", 0), nil).Handler())
+	defer ts.Close()
+
+	used := make(map[string]bool)
+	var key string
+	request := func(method, path, body string) (int, interface{}) {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req, err := http.NewRequest(method, ts.URL+strings.Replace(path, "{key}", key, 1), reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		op, err := spec.operation(specPath(req.URL.Path), strings.ToLower(method))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op == nil {
+			t.Fatalf("operation %v %v is not documented", method, path)
+		}
+		used[op.OperationID] = true
+		doc, ok := op.Responses[fmt.Sprint(resp.StatusCode)]
+		if !ok {
+			t.Errorf("%v %v: status %v is not documented", method, path, resp.StatusCode)
+			return resp.StatusCode, nil
+		}
+		doc = spec.response(doc)
+		if len(doc.Content) == 0 {
+			if resp.ContentLength > 0 {
+				t.Errorf("%v %v: unexpected body", method, path)
+			}
+			return resp.StatusCode, nil
+		}
+		media, ok := doc.Content[resp.Header.Get("Content-Type")]
+		if !ok {
+			t.Fatalf("%v %v: content type %q is not documented", method, path, resp.Header.Get("Content-Type"))
+		}
+		var value interface{}
+		if err = json.NewDecoder(resp.Body).Decode(&value); err != nil {
+			t.Fatal(err)
+		}
+		if err = validateSchema(spec, media.Schema, value); err != nil {
+			t.Errorf("%v %v: status %v: %v", method, path, resp.StatusCode, err)
+		}
+		return resp.StatusCode, value
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"POST", "/api/secrets", `{"content":"spec","ttl":"1h","times":2,"password":"pwd"}`, http.StatusCreated},
+		{"POST", "/api/secrets", `{"content":"spec","ttl":"1h"}`, http.StatusBadRequest},
+		{"POST", "/api/secrets", `{"content":"` + strings.Repeat("x", 1<<20) + `","ttl":"1h","times":1}`, http.StatusRequestEntityTooLarge},
+		{"GET", "/api/secrets/{key}", "", http.StatusOK},
+		{"POST", "/api/secrets/{key}/read", `{"password":"bad"}`, http.StatusForbidden},
+		{"POST", "/api/secrets/{key}/read", `{"password":"pwd"}`, http.StatusOK},
+		{"POST", "/api/secrets/{key}/read", `{"pass":"pwd"}`, http.StatusBadRequest},
+		{"DELETE", "/api/secrets/{key}", "", http.StatusNoContent},
+		{"DELETE", "/api/secrets/{key}", "", http.StatusNotFound},
+		{"GET", "/api/secrets/{key}", "", http.StatusNotFound},
+		{"POST", "/api/secrets/{key}/read", `{"password":"pwd"}`, http.StatusNotFound},
+	}
+	for i, c := range cases {
+		code, value := request(c.method, c.path, c.body)
+		if code != c.code {
+			t.Errorf("failed case=%v code=%v", i, code)
+		}
+		if (i == 0) && (code == http.StatusCreated) {
+			key = value.(map[string]interface{})["key"].(string)
+		}
+	}
+	for _, op := range docs.Operations {
+		if !used[op.ID] {
+			t.Errorf("operation %v is not tested", op.ID)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	spec, docs := testSpec(t)
+	cfg, err := conf.Read(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.BasePath = "/enigma/"
+	ts := httptest.NewServer(NewServer(cfg, failStorage{}, log.New(io.Discard, "", 0), nil).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/enigma" + apiSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]interface{} `json:"paths"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if e := resp.Body.Close(); e != nil {
+		t.Errorf("close body error: %v", e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(data.OpenAPI, "3.") || (len(data.Paths) != len(spec.Paths)) {
+		t.Errorf("failed specification: %v, %v", data.OpenAPI, data.Paths)
+	}
+	if len(data.Servers) != 1 {
+		t.Fatalf("failed servers: %v", data.Servers)
+	}
+	specURL, err := url.Parse(ts.URL + "/enigma" + apiSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := specURL.Parse(data.Servers[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := server.String(); s != ts.URL+"/enigma/" {
+		t.Errorf("failed server URL: %v", s)
+	}
+
+	resp, err = http.Get(ts.URL + "/enigma" + apiDocs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if e := resp.Body.Close(); e != nil {
+		t.Errorf("close body error: %v", e)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("failed docs code=%v", resp.StatusCode)
+	}
+	expected := []string{`href="/enigma/api/openapi.json"`}
+	for _, op := range docs.Operations {
+		expected = append(expected, "<code>"+op.Method+" "+op.Path+"</code>")
+	}
+	for name := range spec.Components.Schemas {
+		expected = append(expected, `id="`+name+`"`)
+	}
+	for _, x := range expected {
+		if !strings.Contains(string(body), x) {
+			t.Errorf("%v is not found in docs", x)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+const (
+	// qrSize is QR code PNG image size in pixels.
+	qrSize = 256
+)
+
+// qrSVG returns QR code as SVG image, every module is a square with side 1.
+func qrSVG(q *qrcode.QRCode) []byte {
+	var b strings.Builder
+	bitmap := q.Bitmap()
+	n := len(bitmap)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, black := range row {
+			if black {
+				fmt.Fprintf(&b, "M%d,%dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return []byte(b.String())
+}
+
+// QR returns QR code image with item's URL. Only item's existence is checked,
+// it's not read, so the image doesn't spend item's views.
+// Expected URL is "/qr/<key>.png" or "/qr/<key>.svg".
+func QR(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	name := strings.TrimPrefix(r.URL.Path, "/qr/")
+	ext := path.Ext(name)
+	keys := db.KeyCandidates(strings.TrimSuffix(name, ext))
+	if (len(keys) == 0) || ((ext != ".png") && (ext != ".svg")) {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	item, conn, err := findItem(cfg, keys)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if item == nil {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	err = conn.Close()
+	if err != nil {
+		cfg.Logger().Println("failed connection close after QR code")
+	}
+	q, err := qrcode.New(item.GetURL(r, cfg.Secure, cfg.BasePath).String(), qrcode.Medium)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	var content []byte
+	switch ext {
+	case ".png":
+		content, err = q.PNG(qrSize)
+		if err != nil {
+			return Error(w, r, cfg, http.StatusInternalServerError), err
+		}
+		w.Header().Set("Content-Type", "image/png")
+	case ".svg":
+		content = qrSVG(q)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	default:
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	_, err = w.Write(content)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+func TestQR(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.Connection()
+	item := &db.Item{Content: "Test-QR", TTL: 30, Times: 1}
+	defer func() {
+		_, err := db.Delete(item.Key, conn)
+		if err != nil {
+			t.Errorf("failed delete item: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	err = item.Save(conn, cfg.CipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := item.Key
+	missing := strings.Repeat("a", db.KeyLen*2)
+	values := []struct {
+		path        string
+		code        int
+		contentType string
+	}{
+		{"/qr/" + key + ".png", http.StatusOK, "image/png"},
+		{"/qr/" + key + ".svg", http.StatusOK, "image/svg+xml"},
+		{"/qr/" + key + ".gif", http.StatusNotFound, ""},
+		{"/qr/" + key, http.StatusNotFound, ""},
+		{"/qr/abc.png", http.StatusNotFound, ""},
+		{"/qr/" + missing + ".png", http.StatusNotFound, ""},
+		{"/qr/" + missing + ".svg", http.StatusNotFound, ""},
+	}
+	for i, v := range values {
+		w := httptest.NewRecorder()
+		code, err := QR(w, httptest.NewRequest("GET", v.path, nil), cfg)
+		if err != nil {
+			t.Errorf("unexpected error case=%v: %v", i, err)
+		}
+		if code != v.code {
+			t.Errorf("failed code case=%v: %v", i, code)
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != v.contentType {
+			t.Errorf("failed content type case=%v: %v", i, ct)
+		}
+		body := w.Body.Bytes()
+		switch v.contentType {
+		case "image/png":
+			if !bytes.HasPrefix(body, []byte("\x89PNG")) {
+				t.Errorf("failed png case=%v", i)
+			}
+		case "image/svg+xml":
+			if !bytes.HasPrefix(body, []byte("<svg")) || !bytes.HasSuffix(body, []byte("</svg>")) {
+				t.Errorf("failed svg case=%v", i)
+			}
+		}
+	}
+	// QR code doesn't spend item's views
+	exists, err := item.Exists(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("item was read by QR code")
+	}
+}
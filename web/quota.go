@@ -0,0 +1,137 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+const (
+	// ownerIP is a prefix of client IP address quota owner.
+	ownerIP = "ip:"
+	// ownerCreator is a prefix of authenticated creator quota owner.
+	ownerCreator = "creator:"
+)
+
+// checkForm parses the request form and checks a size of new item's content.
+// It returns an HTTP status code of failed check.
+func checkForm(r *http.Request, cfg *conf.Cfg) int {
+	err := r.ParseForm()
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return http.StatusRequestEntityTooLarge
+		}
+		return http.StatusBadRequest
+	}
+	if len(r.PostFormValue("content")) > cfg.Settings.MaxContent {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusOK
+}
+
+// owners returns quotas owners of new item: client network and its creator if it's known.
+func owners(r *http.Request, creator string) []string {
+	result := []string{ownerIP + clientNet(r)}
+	if creator != "" {
+		result = append(result, ownerCreator+creator)
+	}
+	return result
+}
+
+// quotaReserver checks quotas of new item's owners before its saving,
+// reset is a time when exceeded quota gets free space.
+type quotaReserver struct {
+	cfg   *conf.Cfg
+	reset time.Time
+}
+
+// Reserve adds new item with stored size to quotas of its owners.
+// It returns false if any quota is exceeded, and already reserved ones are released.
+func (q *quotaReserver) Reserve(item *db.Item, size int) (bool, error) {
+	if !q.cfg.Settings.Quota.Enabled() {
+		return true, nil
+	}
+	for i, owner := range item.Owners {
+		// separated connections, because quotas keys are in different cluster slots
+		ok, err := reserveOwner(q.cfg, owner, item, size)
+		if (err == nil) && ok {
+			continue
+		}
+		release(q.cfg, item.Key, item.Owners[:i])
+		if err == nil {
+			q.reset, err = quotaReset(q.cfg, owner)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Release removes not saved item from quotas of its owners.
+func (q *quotaReserver) Release(item *db.Item) {
+	if q.cfg.Settings.Quota.Enabled() {
+		release(q.cfg, item.Key, item.Owners)
+	}
+}
+
+// quotaReset returns a time when owner's quota gets free space.
+func quotaReset(cfg *conf.Cfg, owner string) (time.Time, error) {
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after quota check")
+		}
+	}()
+	return db.Reset(conn, owner)
+}
+
+// setRetryAfter sets Retry-After header of rejected request,
+// the delay is rounded up to seconds.
+func setRetryAfter(w io.Writer, delay time.Duration) {
+	httpWriter, ok := w.(http.ResponseWriter)
+	if !ok {
+		return
+	}
+	seconds := int64(0)
+	if delay > 0 {
+		seconds = int64((delay + time.Second - 1) / time.Second)
+	}
+	httpWriter.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// reserveOwner adds item to quota of one owner.
+func reserveOwner(cfg *conf.Cfg, owner string, item *db.Item, size int) (bool, error) {
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after quota check")
+		}
+	}()
+	return cfg.Settings.Quota.Reserve(conn, owner, item, size, cfg.Now())
+}
+
+// release removes deleted item from quotas of its owners,
+// failed release is only logged, because quotas keys expire with the items.
+func release(cfg *conf.Cfg, key string, itemOwners []string) {
+	for _, owner := range itemOwners {
+		conn := cfg.Connection()
+		err := db.Release(conn, owner, key)
+		if err != nil {
+			cfg.Logger().Printf("failed quota release: %v", err)
+		}
+		if err = conn.Close(); err != nil {
+			cfg.Logger().Println("failed connection close after quota release")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+func TestQuota(t *testing.T) {
+	const remoteAddr = "198.51.100.7:1234"
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Settings.MaxBody, cfg.Settings.MaxContent = 256, 16
+	cfg.Settings.Quota = db.Quota{Count: 2}
+	conn := cfg.Connection()
+	quota := []interface{}{"{quota:ip:198.51.100.7}:items", "{quota:ip:198.51.100.7}:sizes"}
+	var keys, requests []string
+	defer func() {
+		for _, key := range keys {
+			_, err := db.Delete(key, conn)
+			if err != nil {
+				t.Errorf("failed delete item: %v", err)
+			}
+		}
+		for _, key := range requests {
+			_, err := conn.Do("DEL", "request:"+key)
+			if err != nil {
+				t.Errorf("failed delete request: %v", err)
+			}
+		}
+		_, err := conn.Do("DEL", quota...)
+		if err != nil {
+			t.Errorf("failed delete quota: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	_, err = conn.Do("DEL", quota...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Secure(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		switch r.URL.Path {
+		case "/":
+			_, err = Index(w, r, cfg)
+		case "/request":
+			_, err = RequestSecret(w, r, cfg)
+		default:
+			_, err = Read(w, r, cfg)
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}))
+	var retry string // Retry-After header of the last response
+	send := func(path string, params url.Values) (int, string) {
+		cookie := addCSRF(params, cfg)
+		r := httptest.NewRequest("POST", path, strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		retry = w.Header().Get("Retry-After")
+		return w.Code, w.Body.String()
+	}
+	items := func() int {
+		n, err := redis.Int(conn.Do("ZCARD", quota[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	params := url.Values{"content": {strings.Repeat("a", 17)}, "ttl": {"60"}, "times": {"1"}}
+	if code, _ := send("/", params); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("failed large content code=%v", code)
+	}
+	params = url.Values{"content": {"test"}, "ttl": {"60"}, "times": {"1"}, "other": {strings.Repeat("b", 256)}}
+	if code, _ := send("/", params); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("failed large body code=%v", code)
+	}
+	create := func(expected int) {
+		code, body := send("/", url.Values{"content": {"test"}, "ttl": {"60"}, "times": {"1"}})
+		if code != expected {
+			t.Fatalf("failed create code=%v", code)
+		}
+		if finds := rgCheck.FindStringSubmatch(body); len(finds) == 3 {
+			keys = append(keys, finds[2])
+		}
+	}
+	create(http.StatusOK)
+	create(http.StatusOK)
+	create(http.StatusTooManyRequests)
+	// the earliest item expires in 60 seconds
+	if n, err := strconv.Atoi(retry); (err != nil) || (n < 1) || (n > 60) {
+		t.Errorf("failed Retry-After header %q", retry)
+	}
+	if n := items(); (n != 2) || (len(keys) != 2) {
+		t.Fatalf("failed quota items %v", n)
+	}
+	// the last reading releases the quota
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/"+keys[0], nil)
+	handler.ServeHTTP(w, r)
+	finds := regexp.MustCompile(`name="nonce" value="([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if len(finds) != 2 {
+		t.Fatal("nonce is not found")
+	}
+	if code, body := send("/"+keys[0], url.Values{"nonce": {finds[1]}}); (code != http.StatusOK) || !strings.Contains(body, "test") {
+		t.Errorf("failed read code=%v", code)
+	}
+	if n := items(); n != 1 {
+		t.Errorf("quota is not released %v", n)
+	}
+	// secret requests are counted by the same quota
+	rgUpload := regexp.MustCompile(`/upload/([0-9a-f]+)"`)
+	request := func(expected int) {
+		code, body := send("/request", url.Values{"ttl": {"60"}, "times": {"1"}})
+		if code != expected {
+			t.Fatalf("failed request code=%v", code)
+		}
+		if finds := rgUpload.FindStringSubmatch(body); len(finds) == 2 {
+			requests = append(requests, finds[1])
+		}
+	}
+	request(http.StatusOK)
+	if n := items(); (n != 2) || (len(requests) != 1) {
+		t.Fatalf("failed quota items with request %v", n)
+	}
+	request(http.StatusTooManyRequests)
+	if n, err := strconv.Atoi(retry); (err != nil) || (n < 1) || (n > 60) {
+		t.Errorf("failed Retry-After header of request %q", retry)
+	}
+	// expired request frees the quota like items
+	if _, err = conn.Do("ZADD", quota[0], 1, "request:"+requests[0]); err != nil {
+		t.Fatal(err)
+	}
+	create(http.StatusOK)
+}
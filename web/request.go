@@ -0,0 +1,260 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/audit"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+// RequestData is data for secret request form and its links.
+type RequestData struct {
+	Page
+	CSRF    string
+	TTL     string
+	Times   int
+	Upload  string
+	Inbox   string
+	Expires time.Time
+}
+
+// UploadData is data for a form to send requested secret.
+type UploadData struct {
+	Page
+	CSRF      string
+	PublicKey string
+	Sent      bool
+	Err       bool
+	Msg       string
+}
+
+// InboxData is data for requester's page with a link of sent secret.
+type InboxData struct {
+	Page
+	URL string
+}
+
+// absURL returns absolute URL of the service page, path is relative to the base path.
+func absURL(r *http.Request, cfg *conf.Cfg, path string) string {
+	// r.URL.Scheme is blank, so use hint from settings
+	scheme := "http"
+	if cfg.Secure {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: r.Host, Path: strings.TrimSuffix(cfg.BasePath, "/") + path}
+	return u.String()
+}
+
+// loadRequest returns a request by a key from URL, it's nil if the request is not found.
+// See findKey about returned connection.
+func loadRequest(cfg *conf.Cfg, raw string) (*db.Request, redis.Conn, error) {
+	var req *db.Request
+	_, conn, err := findKey(cfg, db.KeyCandidates(raw), func(c redis.Conn, key string) (bool, error) {
+		req = &db.Request{Key: key}
+		return req.Load(c)
+	})
+	if (err != nil) || (conn == nil) {
+		return nil, nil, err
+	}
+	return req, conn, nil
+}
+
+// RequestSecret handles "/request" to ask other person for a secret.
+// GET request shows a form, POST one creates new request
+// and returns a public upload link and a private inbox one.
+func RequestSecret(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
+	tpl := cfg.Templates["request"]
+	if r.Method != "POST" {
+		token, err := csrfToken(w, r, cfg)
+		if err != nil {
+			return Error(w, r, cfg, http.StatusInternalServerError), err
+		}
+		err = tpl.Execute(w, &RequestData{
+			Page:  newPage(r, cfg),
+			CSRF:  token,
+			TTL:   db.FormatTTL(cfg.Settings.FormTTL),
+			Times: cfg.Settings.Times,
+		})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+	creator, code := checkCreator(r, cfg)
+	if code != http.StatusOK {
+		return Error(w, r, cfg, code), nil
+	}
+	req, err := db.NewRequest(r, cfg.Now(), cfg.Settings.MinTTL, cfg.Settings.TTL, cfg.Settings.Times)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusBadRequest), err
+	}
+	req.Creator = creator
+	req.Format = &cfg.Settings.KeyFormat
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after request creation")
+		}
+	}()
+	req.Owners = owners(r, creator)
+	quota := &quotaReserver{cfg: cfg}
+	ok, err := req.SaveReserved(conn, quota)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if !ok {
+		setRetryAfter(w, quota.reset.Sub(cfg.Now()))
+		return Error(w, r, cfg, http.StatusTooManyRequests), nil
+	}
+	data := &RequestData{
+		Page:    newPage(r, cfg),
+		Upload:  absURL(r, cfg, "/upload/"+req.Key),
+		Inbox:   absURL(r, cfg, "/inbox/"+req.Key+"/"+req.Token),
+		Expires: cfg.Now().Add(time.Duration(req.TTL) * time.Second),
+	}
+	err = tpl.Execute(w, data)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return http.StatusOK, nil
+}
+
+// uploadPage shows upload form or its result, msg is a translation key of optional error message.
+func uploadPage(w io.Writer, r *http.Request, cfg *conf.Cfg, data *UploadData, code int, msg string) (int, error) {
+	if code != http.StatusOK {
+		httpWriter, ok := w.(http.ResponseWriter)
+		if !ok {
+			return Error(w, r, cfg, http.StatusInternalServerError), nil
+		}
+		httpWriter.WriteHeader(code)
+	}
+	if msg != "" {
+		data.Err, data.Msg = true, data.L.Get(msg)
+	}
+	tpl := cfg.Templates["upload"]
+	err := tpl.Execute(w, data)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return code, nil
+}
+
+// Upload handles "/upload/<key>" to send requested secret.
+// The secret becomes a usual item, and only the requester gets its link.
+func Upload(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
+	req, conn, err := loadRequest(cfg, strings.TrimPrefix(r.URL.Path, "/upload/"))
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if req == nil {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after upload")
+		}
+	}()
+	// sent item gets a key of current settings
+	req.Format = &cfg.Settings.KeyFormat
+	data := &UploadData{Page: newPage(r, cfg), PublicKey: req.PublicKey}
+	if req.ItemKey != "" {
+		return uploadPage(w, r, cfg, data, http.StatusGone, "upload_used")
+	}
+	if r.Method != "POST" {
+		data.CSRF, err = csrfToken(w, r, cfg)
+		if err != nil {
+			return Error(w, r, cfg, http.StatusInternalServerError), err
+		}
+		return uploadPage(w, r, cfg, data, http.StatusOK, "")
+	}
+	if code := checkForm(r, cfg); code != http.StatusOK {
+		return Error(w, r, cfg, code), nil
+	}
+	if !checkCSRF(r, cfg) {
+		return Error(w, r, cfg, http.StatusForbidden), nil
+	}
+	item, err := req.NewItem(r.PostFormValue("content"))
+	if err != nil {
+		return Error(w, r, cfg, http.StatusBadRequest), err
+	}
+	// separated connection, because a cluster one is bound to the request key slot
+	itemConn := cfg.Connection()
+	defer func() {
+		err := itemConn.Close()
+		if err != nil {
+			cfg.Logger().Println("failed connection close after upload")
+		}
+	}()
+	item.Owners = owners(r, item.Creator)
+	quota := &quotaReserver{cfg: cfg}
+	ok, err := item.SaveReserved(itemConn, cfg.CipherKey, quota)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if !ok {
+		setRetryAfter(w, quota.reset.Sub(cfg.Now()))
+		return Error(w, r, cfg, http.StatusTooManyRequests), nil
+	}
+	logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionCreate, Creator: item.Creator, Times: item.Times})
+	err = req.Fill(conn, item)
+	if err != nil {
+		// concurrent upload has already sent a secret, so this one is not needed
+		if _, e := db.Delete(item.Key, itemConn); e != nil {
+			cfg.Logger().Printf("failed delete not requested item: %v", e)
+		} else {
+			logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionDelete, Creator: item.Creator})
+			release(cfg, item.Key, item.Owners)
+		}
+		if err == db.ErrRequestUsed {
+			return uploadPage(w, r, cfg, data, http.StatusGone, "upload_used")
+		}
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	data.Sent = true
+	return uploadPage(w, r, cfg, data, http.StatusOK, "")
+}
+
+// Inbox handles "/inbox/<key>/<token>", it's requester's private page
+// that shows a link of sent secret.
+func Inbox(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/inbox/"), "/")
+	if len(parts) != 2 {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	req, conn, err := loadRequest(cfg, parts[0])
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if req == nil {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	err = conn.Close()
+	if err != nil {
+		cfg.Logger().Println("failed connection close after inbox")
+	}
+	if !req.CheckToken(parts[1]) {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	data := &InboxData{Page: newPage(r, cfg)}
+	if req.ItemKey != "" {
+		data.URL = (&db.Item{Key: req.ItemKey}).GetURL(r, cfg.Secure, cfg.BasePath).String()
+	}
+	tpl := cfg.Templates["inbox"]
+	err = tpl.Execute(w, data)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+func TestRequestSecret(t *testing.T) {
+	const publicKey = "BEI55eV6-Wc8c2gpjMvkOKvybS5CBn-Zm1X7sHoZNqOG0vtG3ZdtMj52OCDhHwMuYe3IB-0toqpkhv5h4JUings"
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.Connection()
+	var keys []interface{}
+	defer func() {
+		if len(keys) > 0 {
+			_, err := conn.Do("DEL", keys...)
+			if err != nil {
+				t.Errorf("failed delete keys: %v", err)
+			}
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	type handler func(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error)
+	send := func(h handler, method, path string, params url.Values) (int, string) {
+		cookie := addCSRF(params, cfg)
+		r := httptest.NewRequest(method, path, strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		code, err := h(w, r, cfg)
+		if err != nil && (code != http.StatusBadRequest) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return code, w.Body.String()
+	}
+	code, body := send(RequestSecret, "GET", "/request", url.Values{})
+	if code != http.StatusOK {
+		t.Errorf("failed GET code=%v", code)
+	}
+	if !strings.Contains(body, fmt.Sprintf(`name="times" min="1" max="%d"`, cfg.Settings.Times)) {
+		t.Error("failed times limit")
+	}
+	code, _ = send(RequestSecret, "POST", "/request", url.Values{"ttl": {"60"}, "times": {"1"}, "public_key": {"abc"}})
+	if code != http.StatusBadRequest {
+		t.Errorf("failed invalid public key code=%v", code)
+	}
+	params := url.Values{"ttl": {"60"}, "times": {"1"}, "public_key": {publicKey}}
+	code, body = send(RequestSecret, "POST", "/request", params)
+	if code != http.StatusOK {
+		t.Fatalf("failed POST code=%v", code)
+	}
+	rgLinks := regexp.MustCompile(`value="http://[^/]+(/upload/[0-9a-f]+)"[^$]+value="http://[^/]+(/inbox/([0-9a-f]+)/[0-9a-f]+)"`)
+	finds := rgLinks.FindStringSubmatch(body)
+	if len(finds) != 4 {
+		t.Fatal("request links are not found")
+	}
+	upload, inbox := finds[1], finds[2]
+	keys = append(keys, "request:"+finds[3])
+
+	code, body = send(Inbox, "GET", inbox, url.Values{})
+	if (code != http.StatusOK) || strings.Contains(body, "data-e2e-link") {
+		t.Errorf("failed waiting inbox code=%v", code)
+	}
+	code, _ = send(Inbox, "GET", inbox+"0", url.Values{})
+	if code != http.StatusNotFound {
+		t.Errorf("failed invalid token code=%v", code)
+	}
+	code, body = send(Upload, "GET", upload, url.Values{})
+	if (code != http.StatusOK) || !strings.Contains(body, publicKey) {
+		t.Errorf("failed upload form code=%v", code)
+	}
+	code, _ = send(Upload, "POST", upload, url.Values{"content": {"plain text"}})
+	if code != http.StatusBadRequest {
+		t.Errorf("failed not encrypted upload code=%v", code)
+	}
+	content := db.E2EPrefix + "encrypted"
+	code, _ = send(Upload, "POST", upload, url.Values{"content": {content}})
+	if code != http.StatusOK {
+		t.Errorf("failed upload code=%v", code)
+	}
+	code, _ = send(Upload, "POST", upload, url.Values{"content": {content}})
+	if code != http.StatusGone {
+		t.Errorf("failed repeated upload code=%v", code)
+	}
+	code, body = send(Inbox, "GET", inbox, url.Values{})
+	if code != http.StatusOK {
+		t.Errorf("failed inbox code=%v", code)
+	}
+	finds = regexp.MustCompile(`value="http://[^/]+/([0-9a-f]{128})"`).FindStringSubmatch(body)
+	if len(finds) != 2 {
+		t.Fatal("secret link is not found")
+	}
+	keys = append(keys, finds[1])
+	item := &db.Item{Key: finds[1]}
+	exists, err := item.Exists(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("sent item is not found")
+	}
+	code, _ = send(Upload, "GET", "/upload/abc", url.Values{})
+	if code != http.StatusNotFound {
+		t.Errorf("failed absent request code=%v", code)
+	}
+}
+
+func TestUpload_KeyFormat(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Settings.KeyFormat = db.KeyFormat{Len: 10, Encoding: db.EncodingBase32}
+	conn := cfg.Connection()
+	var keys []interface{}
+	defer func() {
+		if len(keys) > 0 {
+			_, err := conn.Do("DEL", keys...)
+			if err != nil {
+				t.Errorf("failed delete keys: %v", err)
+			}
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	req := &db.Request{TTL: 60, Times: 1, Format: &cfg.Settings.KeyFormat}
+	err = req.Save(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, "request:"+req.Key)
+	params := url.Values{"content": {"secret"}}
+	cookie := addCSRF(params, cfg)
+	r := httptest.NewRequest("POST", "/upload/"+req.Key, strings.NewReader(params.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookie)
+	code, err := Upload(httptest.NewRecorder(), r, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Fatalf("failed upload code=%v", code)
+	}
+	ok, err := req.Load(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || (req.ItemKey == "") {
+		t.Fatal("sent item is not linked")
+	}
+	keys = append(keys, req.ItemKey)
+	if !regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{16}$`).MatchString(req.ItemKey) {
+		t.Errorf("item key doesn't match format: %v", req.ItemKey)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+const (
+	// csrfName is CSRF cookie and form field name.
+	csrfName = "csrf"
+	// csrfLen is a number of random bytes of CSRF cookie.
+	csrfLen = 32
+)
+
+// Secure is a middleware that sets configured security headers to every response
+// and limits a size of request body.
+func Secure(cfg *conf.Cfg, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for name, value := range cfg.Headers {
+			h.Set(name, value)
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, cfg.Settings.MaxBody)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfSign returns CSRF token for cookie value.
+func csrfSign(value string, cfg *conf.Cfg) string {
+	mac := hmac.New(sha256.New, cfg.CipherKey)
+	mac.Write([]byte(csrfName + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken returns CSRF token for HTML form.
+// It sets new CSRF cookie if the request doesn't contain it,
+// so it should be called before any response writing.
+func csrfToken(w io.Writer, r *http.Request, cfg *conf.Cfg) (string, error) {
+	cookie, err := r.Cookie(csrfName)
+	if (err == nil) && (len(cookie.Value) == csrfLen*2) {
+		return csrfSign(cookie.Value, cfg), nil
+	}
+	httpWriter, ok := w.(http.ResponseWriter)
+	if !ok {
+		return "", errors.New("csrf cookie can not be set")
+	}
+	var b [csrfLen]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	value := hex.EncodeToString(b[:])
+	http.SetCookie(httpWriter, &http.Cookie{
+		Name:     csrfName,
+		Value:    value,
+		Path:     cfg.BasePath,
+		Secure:   cfg.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return csrfSign(value, cfg), nil
+}
+
+// checkCSRF returns true if POST form contains valid CSRF token.
+func checkCSRF(r *http.Request, cfg *conf.Cfg) bool {
+	cookie, err := r.Cookie(csrfName)
+	if (err != nil) || (len(cookie.Value) != csrfLen*2) {
+		return false
+	}
+	token := r.PostFormValue(csrfName)
+	return hmac.Equal([]byte(token), []byte(csrfSign(cookie.Value, cfg)))
+}
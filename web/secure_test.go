@@ -0,0 +1,120 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/enigma/conf"
+)
+
+func TestSecure(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	handler := Secure(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	headers := []string{
+		"Content-Security-Policy", "X-Frame-Options", "Referrer-Policy", "Cache-Control",
+	}
+	for _, name := range headers {
+		if value := w.Header().Get(name); value != cfg.Headers[name] || value == "" {
+			t.Errorf("failed header %v: %v", name, value)
+		}
+	}
+	if value := w.Header().Get("Cache-Control"); value != "no-store" {
+		t.Errorf("failed cache control: %v", value)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	// new cookie is set for the first request
+	w := httptest.NewRecorder()
+	token, err := csrfToken(w, httptest.NewRequest("GET", "/", nil), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("failed cookies: %v", cookies)
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || (cookie.Name != csrfName) {
+		t.Errorf("failed cookie: %v", cookie)
+	}
+	// existing cookie is reused
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	other, err := csrfToken(w, r, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != token {
+		t.Error("token is changed")
+	}
+	if n := len(w.Result().Cookies()); n != 0 {
+		t.Errorf("unexpected new cookies: %v", n)
+	}
+	cases := []struct {
+		cookie *http.Cookie
+		token  string
+		ok     bool
+	}{
+		{cookie: cookie, token: token, ok: true},
+		{cookie: cookie, token: "", ok: false},
+		{cookie: cookie, token: strings.Repeat("0", len(token)), ok: false},
+		{cookie: nil, token: token, ok: false},
+		{cookie: &http.Cookie{Name: csrfName, Value: "abc"}, token: csrfSign("abc", cfg), ok: false},
+	}
+	for i, v := range cases {
+		params := url.Values{}
+		params.Set(csrfName, v.token)
+		r := httptest.NewRequest("POST", "/", strings.NewReader(params.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if v.cookie != nil {
+			r.AddCookie(v.cookie)
+		}
+		if ok := checkCSRF(r, cfg); ok != v.ok {
+			t.Errorf("failed case=%v: %v", i, ok)
+		}
+	}
+	// POST without token is forbidden
+	params := url.Values{}
+	params.Set("content", "test")
+	params.Set("ttl", "10")
+	params.Set("times", "1")
+	r = httptest.NewRequest("POST", "/", strings.NewReader(params.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	code, err := Index(w, r, cfg)
+	if err != nil {
+		t.Error(err)
+	}
+	if code != http.StatusForbidden {
+		t.Errorf("failed code: %v", code)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Alexander Zaytsev <thebestzorro@yandex.ru>.
+// All rights reserved. Use of this source code is governed
+// by a MIT-style license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+// Server is HTTP service of secrets. Its handler can be mounted into other application
+// using configured base path, and it can be tested by httptest with a custom storage.
+type Server struct {
+	// Version is service version information for "/version" page.
+	Version string
+	// AccessLog is a logger of handled requests, they are not logged if it's nil.
+	AccessLog *log.Logger
+	storage   db.Pool
+	logger    *log.Logger
+	clock     func() time.Time
+	current   atomic.Pointer[conf.Cfg]
+	health    Health
+}
+
+// NewServer returns new server with the configuration and dependencies:
+// a storage of database connections, errors logger and clock.
+// Nil dependencies are taken from the configuration or default ones.
+func NewServer(cfg *conf.Cfg, storage db.Pool, logger *log.Logger, clock func() time.Time) *Server {
+	s := &Server{storage: storage, logger: logger, clock: clock}
+	s.Reload(cfg)
+	return s
+}
+
+// Reload replaces server's configuration, active requests are finished with the old one.
+func (s *Server) Reload(cfg *conf.Cfg) {
+	s.current.Store(cfg.With(s.storage, s.logger, s.clock))
+}
+
+// Cfg returns current server's configuration.
+func (s *Server) Cfg() *conf.Cfg {
+	return s.current.Load()
+}
+
+// Health returns in-flight requests and readiness tracker of the server.
+func (s *Server) Health() *Health {
+	return &s.health
+}
+
+// Handler returns HTTP handler of the server.
+func (s *Server) Handler() http.Handler {
+	return s.health.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every request uses one configuration snapshot, even if it's reloaded meanwhile
+		cfg := s.Cfg()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.handle(w, r, cfg)
+		})
+		Recover(cfg, Secure(cfg, stripBase(cfg, handler))).ServeHTTP(w, r)
+	}))
+}
+
+// stripBase is a middleware that removes configured base path from request URL,
+// requests outside of the base path are not found.
+func stripBase(cfg *conf.Cfg, next http.Handler) http.Handler {
+	if cfg.BasePath == "/" {
+		return next
+	}
+	prefix := strings.TrimSuffix(cfg.BasePath, "/")
+	strip := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, cfg.BasePath):
+			strip.ServeHTTP(w, r)
+		case r.URL.Path == prefix:
+			http.Redirect(w, r, cfg.BasePath, http.StatusMovedPermanently)
+		default:
+			Error(w, r, cfg, http.StatusNotFound)
+		}
+	})
+}
+
+// handle calls a handler of the request path.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) {
+	var err error
+	// a panic is logged as internal error, it's recovered by the middleware
+	start, code := cfg.Now(), http.StatusInternalServerError
+	defer func() {
+		if s.AccessLog != nil {
+			s.AccessLog.Printf("%-5v %v\t%-12v\t%v", r.Method, code, cfg.Now().Sub(start), r.URL.String())
+		}
+	}()
+	switch path := r.URL.Path; {
+	case path == "/version":
+		code, err = s.version(w, cfg)
+	case path == "/ready":
+		code, err = s.health.Ready(w)
+	case path == "/":
+		code, err = Index(w, r, cfg)
+	case strings.HasPrefix(path, "/static/"):
+		code, err = Static(w, r, cfg)
+	case strings.HasPrefix(path, "/qr/"):
+		code, err = QR(w, r, cfg)
+	case path == "/code":
+		code, err = Code(w, r, cfg)
+	case path == "/login":
+		code, err = Login(w, r, cfg)
+	case path == "/login/callback":
+		code, err = LoginCallback(w, r, cfg)
+	case path == "/logout":
+		code, err = Logout(w, r, cfg)
+	case path == "/request":
+		code, err = RequestSecret(w, r, cfg)
+	case strings.HasPrefix(path, "/upload/"):
+		code, err = Upload(w, r, cfg)
+	case strings.HasPrefix(path, "/inbox/"):
+		code, err = Inbox(w, r, cfg)
+	case path == "/chat":
+		code, err = Chat(w, r, cfg)
+	case path == apiSpec:
+		code, err = OpenAPI(w, r, cfg)
+	case path == apiDocs:
+		code, err = APIDocumentation(w, r, cfg)
+	case (path == apiSecrets) || strings.HasPrefix(path, apiSecrets+"/"):
+		code, err = API(w, r, cfg)
+	default:
+		code, err = Read(w, r, cfg)
+	}
+	if err != nil {
+		cfg.Logger().Println(err)
+	}
+}
+
+// version writes service version and database status.
+func (s *Server) version(w http.ResponseWriter, cfg *conf.Cfg) (int, error) {
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			cfg.Logger().Printf("failed connection close: %v", err)
+		}
+	}()
+	_, err := fmt.Fprintf(w, "%v\nDb is OK: %v\n", s.Version, db.IsOk(conn))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,323 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+	"github.com/z0rr0/enigma/conf"
+	"github.com/z0rr0/enigma/db"
+)
+
+var errStorage = errors.New("storage is not available")
+
+// failStorage is a storage without database, all its commands fail.
+type failStorage struct{}
+
+func (failStorage) Get() redis.Conn { return failConn{} }
+func (failStorage) Close() error    { return nil }
+
+// failConn is a connection of failStorage.
+type failConn struct{}
+
+func (failConn) Close() error                                   { return nil }
+func (failConn) Err() error                                     { return errStorage }
+func (failConn) Do(string, ...interface{}) (interface{}, error) { return nil, errStorage }
+func (failConn) Send(string, ...interface{}) error              { return errStorage }
+func (failConn) Flush() error                                   { return errStorage }
+func (failConn) Receive() (interface{}, error)                  { return nil, errStorage }
+
+// memStorage is an in-memory storage of items hashes and their TTLs in milliseconds,
+// it supports only commands of items lookup without changes.
+// If nodes is set, slots are split between them like in Redis Cluster,
+// and a connection is bound to the node of its first key.
+type memStorage struct {
+	items map[string]map[string]string
+	ttl   map[string]int64
+	nodes int
+}
+
+func (s *memStorage) Get() redis.Conn { return &memConn{s: s, node: -1} }
+func (s *memStorage) Close() error    { return nil }
+
+// memConn is a connection of memStorage.
+type memConn struct {
+	s    *memStorage
+	node int
+}
+
+// slotNode returns a cluster node of the key.
+func (s *memStorage) slotNode(key string) int {
+	return redisc.Slot(key) * s.nodes / redisc.HashSlots
+}
+
+func (*memConn) Close() error                      { return nil }
+func (*memConn) Err() error                        { return nil }
+func (*memConn) Send(string, ...interface{}) error { return errStorage }
+func (*memConn) Flush() error                      { return errStorage }
+func (*memConn) Receive() (interface{}, error)     { return nil, errStorage }
+
+func (c *memConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "PING" {
+		return "PONG", nil
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no arguments of %v", cmd)
+	}
+	key := fmt.Sprint(args[0])
+	if c.s.nodes > 0 {
+		node := c.s.slotNode(key)
+		if c.node < 0 {
+			c.node = node
+		}
+		if c.node != node {
+			return nil, redis.Error(fmt.Sprintf("MOVED %d 127.0.0.1:%d", redisc.Slot(key), 7000+node))
+		}
+	}
+	item, ok := c.s.items[key]
+	switch cmd {
+	case "HEXISTS":
+		if _, ok = item[fmt.Sprint(args[1])]; ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "HMGET":
+		values := make([]interface{}, len(args)-1)
+		for i, field := range args[1:] {
+			if value, ok := item[fmt.Sprint(field)]; ok {
+				values[i] = []byte(value)
+			}
+		}
+		return values, nil
+	case "PTTL":
+		if !ok {
+			return int64(-2), nil
+		}
+		return c.s.ttl[key], nil
+	}
+	return nil, fmt.Errorf("unsupported command %v", cmd)
+}
+
+func TestServer(t *testing.T) {
+	cfg, err := conf.Read(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errLog, access bytes.Buffer
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewServer(cfg, failStorage{}, log.New(&errLog, "", 0), func() time.Time {
+		return now
+	})
+	s.Version = "Enigma test"
+	s.AccessLog = log.New(&access, "", 0)
+	ts := httptest.NewServer(http.StripPrefix("/enigma", s.Handler()))
+	defer ts.Close()
+
+	cases := []struct {
+		path     string
+		code     int
+		expected string
+	}{
+		{"/enigma/", http.StatusOK, `name="csrf"`},
+		{"/enigma/static/style.css", http.StatusOK, "body"},
+		{"/enigma/ready", http.StatusOK, "ready"},
+		{"/enigma/version", http.StatusOK, "Enigma test\nDb is OK: false"},
+		{"/enigma/" + strings.Repeat("ab", 64), http.StatusInternalServerError, "it is an error"},
+		{"/enigma/unknown", http.StatusNotFound, "Page not found"},
+	}
+	for i, c := range cases {
+		resp, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if e := resp.Body.Close(); e != nil {
+			t.Errorf("close body error: %v", e)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != c.code {
+			t.Errorf("failed case=%v code=%v", i, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), c.expected) {
+			t.Errorf("failed case=%v body: %s", i, body)
+		}
+		if resp.Header.Get("X-Frame-Options") == "" {
+			t.Errorf("failed case=%v: no security headers", i)
+		}
+	}
+	if !strings.Contains(errLog.String(), errStorage.Error()) {
+		t.Errorf("storage error is not logged: %v", errLog.String())
+	}
+	if !strings.Contains(access.String(), "GET   500\t0s") {
+		t.Errorf("failed access log: %v", access.String())
+	}
+	// new configuration keeps injected dependencies
+	other := *cfg
+	other.Settings.TTL = 42
+	s.Reload(&other)
+	if x := s.Cfg(); (x.Settings.TTL != 42) || !x.Now().Equal(now) {
+		t.Errorf("failed reload: %v, %v", x.Settings.TTL, x.Now())
+	}
+	if cfg.Now().Equal(now) {
+		t.Error("original configuration is changed")
+	}
+}
+
+func TestServer_BasePath(t *testing.T) {
+	cfg, err := conf.Read(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.BasePath = "/enigma/"
+	ts := httptest.NewServer(NewServer(cfg, failStorage{}, log.New(io.Discard, "", 0), nil).Handler())
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	cases := []struct {
+		path     string
+		code     int
+		expected []string
+	}{
+		{"/enigma/", http.StatusOK, []string{
+			`href="/enigma/static/style.css"`, `href="/enigma/request"`, `<a href="/enigma/" `,
+		}},
+		{"/enigma/request", http.StatusOK, []string{`src="/enigma/static/enigma.js"`}},
+		{"/enigma/static/style.css", http.StatusOK, []string{"body"}},
+		{"/enigma", http.StatusMovedPermanently, nil},
+		{"/", http.StatusNotFound, []string{`href="/enigma/"`}},
+		{"/static/style.css", http.StatusNotFound, nil},
+	}
+	for i, c := range cases {
+		resp, err := client.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if e := resp.Body.Close(); e != nil {
+			t.Errorf("close body error: %v", e)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != c.code {
+			t.Errorf("failed case=%v code=%v", i, resp.StatusCode)
+		}
+		for _, expected := range c.expected {
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("failed case=%v, %v is not found", i, expected)
+			}
+		}
+		if c.path == "/enigma/" {
+			cookies := resp.Cookies()
+			if (len(cookies) != 1) || (cookies[0].Path != "/enigma/") {
+				t.Errorf("failed CSRF cookie: %v", cookies)
+			}
+		}
+		if (c.code == http.StatusMovedPermanently) && (resp.Header.Get("Location") != "/enigma/") {
+			t.Errorf("failed redirect: %v", resp.Header.Get("Location"))
+		}
+	}
+}
+
+func TestServer_Storage(t *testing.T) {
+	cfg, err := conf.Read(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.Repeat("ab", 64)
+	storage := &memStorage{
+		items: map[string]map[string]string{key: {"content": "secret", "times": "2"}},
+		ttl:   map[string]int64{key: 90000},
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewServer(cfg, storage, log.New(io.Discard, "", 0), func() time.Time {
+		return now
+	})
+	s.Version = "Enigma test"
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	cases := []struct {
+		path     string
+		code     int
+		expected string
+	}{
+		{"/version", http.StatusOK, "Enigma test\nDb is OK: true"},
+		{"/" + key, http.StatusOK, `name="nonce"`},
+		{"/" + strings.Repeat("cd", 64), http.StatusNotFound, "Page not found"},
+		{"/api/secrets/" + key, http.StatusOK, `{"times":2,"expires":"2024-03-01T12:01:30Z"}`},
+	}
+	for i, c := range cases {
+		resp, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if e := resp.Body.Close(); e != nil {
+			t.Errorf("close body error: %v", e)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != c.code {
+			t.Errorf("failed case=%v code=%v", i, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), c.expected) {
+			t.Errorf("failed case=%v body: %s", i, body)
+		}
+	}
+}
+
+func TestServer_Cluster(t *testing.T) {
+	cfg, err := conf.Read(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &memStorage{nodes: 2}
+	// base32 link typed in lower case, its first candidate is in other slot than the item
+	raw := "d3kqf7m2x9htpa6c"
+	keys := db.KeyCandidates(raw)
+	key := keys[len(keys)-1]
+	if (len(keys) < 2) || (storage.slotNode(keys[0]) == storage.slotNode(key)) {
+		t.Fatalf("unexpected candidates %v", keys)
+	}
+	storage.items = map[string]map[string]string{key: {"content": "secret", "times": "1"}}
+	storage.ttl = map[string]int64{key: 60000}
+	s := NewServer(cfg, storage, log.New(io.Discard, "", 0), nil)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	cases := []struct {
+		path string
+		code int
+	}{
+		{"/" + raw, http.StatusOK},
+		{"/api/secrets/" + raw, http.StatusOK},
+		{"/qr/" + raw + ".svg", http.StatusOK},
+		{"/" + strings.Repeat("cd", 64), http.StatusNotFound},
+	}
+	for i, c := range cases {
+		resp, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = resp.Body.Close(); err != nil {
+			t.Errorf("close body error: %v", err)
+		}
+		if resp.StatusCode != c.code {
+			t.Errorf("failed case=%v code=%v", i, resp.StatusCode)
+		}
+	}
+}
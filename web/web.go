@@ -3,126 +3,384 @@
 // by a MIT-style license that can be found in the LICENSE file.
 
 // Package web contains HTTP handlers methods.
-// There are 2 URLs:
+// There are 19 URLs:
+// All of them are relative to configured base path.
 // 1. "/" - GET and POST
 // 2. "/<hash>" - GET and POST
+// 3. "/static/<file>" - GET
+// 4. "/qr/<hash>.(png|svg)" - GET
+// 5. "/code" - GET and POST
+// 6. "/request" - GET and POST
+// 7. "/upload/<hash>" - GET and POST
+// 8. "/inbox/<hash>/<token>" - GET
+// 9. "/login", "/login/callback" - GET, "/logout" - POST
+// 10. "/version", "/ready" - GET
+// 11. "/api/secrets" - POST, "/api/secrets/<hash>" - GET and DELETE, "/api/secrets/<hash>/read" - POST
+// 12. "/api/openapi.json", "/api/docs" - GET
+// 13. "/chat" - POST
 package web
 
 import (
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/z0rr0/enigma/audit"
 	"github.com/z0rr0/enigma/conf"
 	"github.com/z0rr0/enigma/db"
+	"github.com/z0rr0/enigma/email"
+	"github.com/z0rr0/enigma/i18n"
+)
+
+const (
+	// nonceTTL is reveal confirmation lifetime in seconds.
+	nonceTTL = 900
 )
 
 var (
-	// internal logger
-	logger = log.New(os.Stderr, fmt.Sprintln("critical error"),
-		log.Ldate|log.Ltime|log.Lshortfile)
+	// previewBots are lowercase User-Agent tokens of link preview robots,
+	// chat apps and mail scanners fetch shared URLs by themselves.
+	// Only exact crawler names are used, generic words match real browsers.
+	previewBots = []string{
+		"slackbot-linkexpanding", "slack-imgproxy", "facebookexternalhit",
+		"twitterbot", "skypeuripreview", "discordbot", "telegrambot",
+		"linkedinbot", "bingpreview", "embedly", "quora link preview",
+		"vkshare", "mattermost-bot", "googlebot", "applebot",
+	}
 )
 
+// Page is common data for all HTML templates.
+// Base is URL path prefix of the service, it ends with a slash.
+type Page struct {
+	Lang string
+	Base string
+	L    i18n.Messages
+}
+
 // ErrorData is a struct for error handling.
 type ErrorData struct {
+	Page
 	Title string
 	Msg   string
 }
 
-// CheckPassword is data for failed password check.
+// CheckPassword is data for read page form and failed password check.
 type CheckPassword struct {
-	Err bool
-	Msg string
+	Page
+	Err   bool
+	Msg   string
+	Nonce string
+	CSRF  string
+	Code  string
+}
+
+// IndexData is data for new item form, Mail is true if links can be sent by email by the creator.
+// Anonymous is true if creators should be authenticated but the user isn't,
+// LoginURL is not empty if web UI login is available. Times is maximum number of readings,
+// TTL is default TTL of the form.
+type IndexData struct {
+	Page
+	CSRF      string
+	TTL       string
+	Times     int
+	Codes     bool
+	Mail      bool
+	Creator   string
+	Anonymous bool
+	LoginURL  string
+}
+
+// ResultData is data for link sharing, Deliveries are statuses of sent emails.
+type ResultData struct {
+	Page
+	URL        string
+	QR         string
+	Code       string
+	Expires    time.Time
+	Times      int
+	Deliveries []Delivery
+}
+
+// ContentData is data with decrypted user's content.
+type ContentData struct {
+	Page
+	Content string
+	Ext     string
+	Times   int
+	Expires time.Time
+}
+
+// logEvent writes item's lifecycle event to audit log,
+// failed writing doesn't break the request.
+func logEvent(r *http.Request, cfg *conf.Cfg, key string, e *audit.Event) {
+	e.IP = clientIP(r)
+	err := cfg.Audit.Log(key, e, cfg.Now())
+	if err != nil {
+		cfg.Logger().Printf("failed audit event %v: %v", e.Action, err)
+	}
+}
+
+// newPage returns common template data with translated strings
+// for the language preferred by the user.
+func newPage(r *http.Request, cfg *conf.Cfg) Page {
+	lang := cfg.Catalog.Negotiate(r.Header.Get("Accept-Language"))
+	return Page{Lang: lang, Base: cfg.BasePath, L: cfg.Catalog.Messages(lang)}
 }
 
 // Error sets error page. It returns code value.
-func Error(w io.Writer, cfg *conf.Cfg, code int) int {
-	var title, msg string
+func Error(w io.Writer, r *http.Request, cfg *conf.Cfg, code int) int {
 	httpWriter, ok := w.(http.ResponseWriter)
 	if ok {
 		httpWriter.WriteHeader(code)
 	}
 	tpl := cfg.Templates["error"]
+	p := newPage(r, cfg)
+	title, msg := p.L.Get("error_title"), p.L.Get("error_msg")
 	switch code {
-	case http.StatusNotFound:
-		title, msg = "Not found", "Page not found"
-	case http.StatusBadRequest:
-		title, msg = "Error", "Bad createData"
-	default:
-		title, msg = "Error", "Sorry, it is an error"
-	}
-	data := &ErrorData{title, msg}
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusUnauthorized,
+		http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		title = p.L.Get(fmt.Sprintf("error_%d_title", code))
+		msg = p.L.Get(fmt.Sprintf("error_%d_msg", code))
+	}
+	data := &ErrorData{p, title, msg}
 	err := tpl.Execute(w, data)
 	if err != nil {
-		logger.Println("error-template execute failed")
+		cfg.Logger().Println("error-template execute failed")
 		return http.StatusInternalServerError
 	}
 	return code
 }
 
-// create handles new item creation.
-func create(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
-	item, err := db.New(r, cfg.Settings.TTL, cfg.Settings.Times)
+// Static returns theme's static files.
+func Static(w http.ResponseWriter, r *http.Request, cfg *conf.Cfg) (int, error) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if !fs.ValidPath(name) {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	f, err := cfg.Static.Open(name)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			cfg.Logger().Println("failed static file close")
+		}
+	}()
+	info, err := f.Stat()
 	if err != nil {
-		return Error(w, cfg, http.StatusBadRequest), err
+		return Error(w, r, cfg, http.StatusInternalServerError), err
 	}
+	content, ok := f.(io.ReadSeeker)
+	if info.IsDir() || !ok {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	// static files are public, so they can be cached unlike other pages
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+	return http.StatusOK, nil
+}
+
+// save stores new item of the creator and reserves quotas of its owners.
+// It returns HTTP status code of failed saving, Retry-After header is set for exceeded quota.
+func save(w io.Writer, r *http.Request, cfg *conf.Cfg, item *db.Item, creator string, itemOwners []string) (int, error) {
 	conn := cfg.Connection()
 	defer func() {
 		err := conn.Close()
 		if err != nil {
-			logger.Println("failed connection close after creation")
+			cfg.Logger().Println("failed connection close after creation")
 		}
 	}()
-	err = item.Save(conn, cfg.CipherKey)
+	item.Creator = creator
+	item.Format = &cfg.Settings.KeyFormat
+	item.Owners = itemOwners
+	// quotas are checked before saving, so rejected items are never stored
+	quota := &quotaReserver{cfg: cfg}
+	ok, err := item.SaveReserved(conn, cfg.CipherKey, quota)
 	if err != nil {
-		return Error(w, cfg, http.StatusInternalServerError), err
+		return http.StatusInternalServerError, err
 	}
-	tpl := cfg.Templates["result"]
-	err = tpl.Execute(w, map[string]string{"URL": item.GetURL(r, cfg.Secure).String()})
-	if err != nil {
-		return Error(w, cfg, http.StatusInternalServerError), err
+	if !ok {
+		setRetryAfter(w, quota.reset.Sub(cfg.Now()))
+		return http.StatusTooManyRequests, nil
 	}
+	logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionCreate, Creator: item.Creator, Times: item.Times})
 	return http.StatusOK, nil
 }
 
-// get user's data.
-func get(w io.Writer, r *http.Request, item *db.Item, c redis.Conn, cfg *conf.Cfg) (int, error) {
-	item.Password = r.PostFormValue("password")
-	ok, err := item.CheckPassword(c)
+// create handles new item creation.
+func create(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
+	code := checkForm(r, cfg)
+	if code != http.StatusOK {
+		return Error(w, r, cfg, code), nil
+	}
+	creator, code := checkCreator(r, cfg)
+	if code != http.StatusOK {
+		return Error(w, r, cfg, code), nil
+	}
+	item, err := db.New(r, cfg.Now(), cfg.Settings.MinTTL, cfg.Settings.TTL, cfg.Settings.Times)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusBadRequest), err
+	}
+	links, passwords, code := mailRecipients(r, cfg, creator)
+	if code != http.StatusOK {
+		return Error(w, r, cfg, code), nil
+	}
+	ok, err := mailAllowed(r, cfg, creator, len(links)+len(passwords))
 	if err != nil {
-		return Error(w, cfg, http.StatusInternalServerError), err
+		return Error(w, r, cfg, http.StatusInternalServerError), err
 	}
 	if !ok {
-		tpl := cfg.Templates["read"]
+		setRetryAfter(w, email.LimitWindow*time.Second)
+		return Error(w, r, cfg, http.StatusTooManyRequests), nil
+	}
+	item.Code = cfg.Settings.Codes && (r.PostFormValue("code") != "")
+	code, err = save(w, r, cfg, item, creator, owners(r, creator))
+	if code != http.StatusOK {
+		mailRefund(r, cfg, creator, len(links)+len(passwords))
+		return Error(w, r, cfg, code), err
+	}
+	data := &ResultData{
+		Page:    newPage(r, cfg),
+		URL:     item.GetURL(r, cfg.Secure, cfg.BasePath).String(),
+		QR:      cfg.BasePath + "qr/" + item.Key,
+		Expires: cfg.Now().Add(time.Duration(item.TTL) * time.Second),
+		Times:   item.Times,
+	}
+	if item.Code {
+		data.QR, data.Code = "", strings.TrimPrefix(item.Key, db.CodePrefix)
+	}
+	if len(links)+len(passwords) > 0 {
+		mail := &MailData{
+			Page:      data.Page,
+			URL:       data.URL,
+			Code:      data.Code,
+			Expires:   data.Expires,
+			Times:     data.Times,
+			Protected: item.Password != "",
+		}
+		data.Deliveries = deliver(r, cfg, mail, item.Password, links, passwords)
+		failed := 0
+		for _, d := range data.Deliveries {
+			if !d.Sent {
+				failed++
+			}
+		}
+		mailRefund(r, cfg, creator, failed)
+	}
+	tpl := cfg.Templates["result"]
+	err = tpl.Execute(w, data)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return http.StatusOK, nil
+}
+
+// isPreviewBot returns true if the request is sent by link preview robot.
+func isPreviewBot(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	for _, name := range previewBots {
+		if strings.Contains(ua, name) {
+			return true
+		}
+	}
+	return false
+}
 
+// readForm shows reveal confirmation form with new signed one-time nonce,
+// msg is a translation key of optional error message.
+func readForm(w io.Writer, r *http.Request, item *db.Item, cfg *conf.Cfg, code int, msg string) (int, error) {
+	token, err := csrfToken(w, r, cfg)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	nonce, err := db.NewNonce(cfg.CipherKey, item.Key, cfg.Now(), nonceTTL)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if code != http.StatusOK {
 		httpWriter, ok := w.(http.ResponseWriter)
 		if !ok {
-			return Error(w, cfg, http.StatusInternalServerError), err
+			return Error(w, r, cfg, http.StatusInternalServerError), nil
 		}
-		code := http.StatusBadRequest
 		httpWriter.WriteHeader(code)
-
-		err = tpl.Execute(w, CheckPassword{true, "Failed password"})
-		if err != nil {
-			return Error(w, cfg, http.StatusInternalServerError), err
-		}
-		return code, nil
 	}
+	p := newPage(r, cfg)
+	if msg != "" {
+		msg = p.L.Get(msg)
+	}
+	tpl := cfg.Templates["read"]
+	phrase := ""
+	if strings.HasPrefix(item.Key, db.CodePrefix) {
+		// codes are not available by links, so the form is sent to codes lookup page
+		phrase = strings.TrimPrefix(item.Key, db.CodePrefix)
+	}
+	err = tpl.Execute(w, &CheckPassword{p, msg != "", msg, nonce, token, phrase})
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	return code, nil
+}
+
+// reveal reads item's content and writes audit events, the last reading releases item's quotas.
+// It returns db.ErrPassword for failed password and false if the item doesn't exist.
+func reveal(r *http.Request, cfg *conf.Cfg, item *db.Item, c redis.Conn) (bool, error) {
 	exists, err := item.Read(c, cfg.CipherKey)
+	if err == db.ErrPassword {
+		logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionFailedPassword})
+		return false, err
+	}
+	if (err != nil) || !exists {
+		return false, err
+	}
+	logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionRead, Times: item.Times})
+	if item.Times < 1 {
+		// the last reading deletes the item
+		logEvent(r, cfg, item.Key, &audit.Event{Action: audit.ActionBurn})
+		release(cfg, item.Key, item.Owners)
+	}
+	return true, nil
+}
+
+// get user's data.
+func get(w io.Writer, r *http.Request, item *db.Item, c redis.Conn, cfg *conf.Cfg) (int, error) {
+	if !checkCSRF(r, cfg) {
+		return Error(w, r, cfg, http.StatusForbidden), nil
+	}
+	ok, err := db.CheckNonce(c, cfg.CipherKey, r.PostFormValue("nonce"), item.Key, cfg.Now())
 	if err != nil {
-		return Error(w, cfg, http.StatusInternalServerError), err
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if !ok {
+		// nonce is absent, expired or already used, so ask to confirm again
+		return readForm(w, r, item, cfg, http.StatusBadRequest, "read_expired")
+	}
+	item.Password = r.PostFormValue("password")
+	exists, err := reveal(r, cfg, item, c)
+	if err == db.ErrPassword {
+		return readForm(w, r, item, cfg, http.StatusBadRequest, "read_failed_password")
+	}
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
 	}
 	if !exists {
-		return Error(w, cfg, http.StatusNotFound), nil
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
+	data := &ContentData{Page: newPage(r, cfg), Content: item.Content, Ext: db.ArmorExt(item.Content), Times: item.Times}
+	if item.Times > 0 {
+		data.Expires, err = item.Expiration(c, cfg.Now())
+		if err != nil {
+			return Error(w, r, cfg, http.StatusInternalServerError), err
+		}
 	}
 	tpl := cfg.Templates["content"]
-	err = tpl.Execute(w, map[string]string{"Content": item.Content})
+	err = tpl.Execute(w, data)
 	if err != nil {
-		return Error(w, cfg, http.StatusInternalServerError), err
+		return Error(w, r, cfg, http.StatusInternalServerError), err
 	}
 	return http.StatusOK, nil
 }
@@ -133,45 +391,102 @@ func Index(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
 	if r.Method == "POST" {
 		return create(w, r, cfg)
 	}
+	token, err := csrfToken(w, r, cfg)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
 	tpl := cfg.Templates["index"]
-	err := tpl.Execute(w, nil)
+	data := &IndexData{
+		Page:  newPage(r, cfg),
+		CSRF:  token,
+		TTL:   db.FormatTTL(cfg.Settings.FormTTL),
+		Times: cfg.Settings.Times,
+		Codes: cfg.Settings.Codes,
+	}
+	data.Creator, _ = cfg.Auth.Creator(r, cfg.Now())
+	data.Mail = cfg.Mail.Allowed(data.Creator)
+	data.Anonymous = cfg.Auth.Enabled() && (data.Creator == "")
+	if cfg.Auth.Login() {
+		data.LoginURL = cfg.BasePath + "login"
+	}
+	err = tpl.Execute(w, data)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 	return http.StatusOK, nil
 }
 
+// findKey returns the first of key candidates that is found and a connection bound to it.
+// Every candidate is checked by own connection, because a cluster one is bound to the slot
+// of its first key, and candidates of different encodings are in different slots.
+// Returned connection is nil if the key is not found, otherwise the caller closes it.
+func findKey(cfg *conf.Cfg, keys []string, found func(c redis.Conn, key string) (bool, error)) (string, redis.Conn, error) {
+	for _, key := range keys {
+		conn := cfg.Connection()
+		ok, err := found(conn, key)
+		if (err == nil) && ok {
+			return key, conn, nil
+		}
+		if e := conn.Close(); e != nil {
+			cfg.Logger().Println("failed connection close after key search")
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return "", nil, nil
+}
+
+// findItem returns existing item by one of key candidates or nil if it's not found,
+// the key can be ambiguous for different encodings. See findKey about returned connection.
+func findItem(cfg *conf.Cfg, keys []string) (*db.Item, redis.Conn, error) {
+	key, conn, err := findKey(cfg, keys, func(c redis.Conn, key string) (bool, error) {
+		return (&db.Item{Key: key}).Exists(c)
+	})
+	if (err != nil) || (conn == nil) {
+		return nil, nil, err
+	}
+	return &db.Item{Key: key}, conn, nil
+}
+
 // Read returns a page with decrypted user's data.
+// GET request shows only reveal confirmation form, and the data is returned
+// for POST with a valid one-time nonce from this form.
 func Read(w io.Writer, r *http.Request, cfg *conf.Cfg) (int, error) {
-	key := strings.Trim(r.RequestURI, "/ ")
-	if len(key) != db.KeyLen*2 {
-		return Error(w, cfg, http.StatusNotFound), nil
+	keys := db.KeyCandidates(strings.Trim(r.URL.Path, "/ "))
+	if len(keys) == 0 {
+		return Error(w, r, cfg, http.StatusNotFound), nil
 	}
 
-	item := &db.Item{Key: key}
-	conn := cfg.Connection()
+	item, conn, err := findItem(cfg, keys)
+	if err != nil {
+		return Error(w, r, cfg, http.StatusInternalServerError), err
+	}
+	if item == nil {
+		return Error(w, r, cfg, http.StatusNotFound), nil
+	}
 	defer func() {
 		err := conn.Close()
 		if err != nil {
-			logger.Println("failed connection close after reading")
+			cfg.Logger().Println("failed connection close after reading")
 		}
 	}()
-	// check items exists
-	exists, err := item.Exists(conn)
-	if err != nil {
-		return Error(w, cfg, http.StatusInternalServerError), err
-	}
-	if !exists {
-		return Error(w, cfg, http.StatusNotFound), nil
-	}
 
+	bot := cfg.Settings.SkipBots && isPreviewBot(r)
 	if r.Method == "POST" {
+		if bot {
+			// link preview robots never spend item's views
+			return Error(w, r, cfg, http.StatusForbidden), nil
+		}
 		return get(w, r, item, conn, cfg)
 	}
-	tpl := cfg.Templates["read"]
-	err = tpl.Execute(w, nil)
-	if err != nil {
-		return http.StatusInternalServerError, err
+	if bot {
+		tpl := cfg.Templates["read"]
+		err = tpl.Execute(w, &CheckPassword{Page: newPage(r, cfg)})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
 	}
-	return http.StatusOK, nil
+	return readForm(w, r, item, cfg, http.StatusOK, "")
 }
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/z0rr0/enigma/conf"
 	"github.com/z0rr0/enigma/db"
 )
@@ -20,7 +21,7 @@ const (
 )
 
 var (
-	rgCheck = regexp.MustCompile(`href="http(s)?://.+/(?P<key>[0-9a-z]{128})"`)
+	rgCheck = regexp.MustCompile(`value="http(s)?://[^"]+/(?P<key>[0-9a-z]{128})"`)
 )
 
 type createData struct {
@@ -38,6 +39,13 @@ type readData struct {
 	Err      bool
 }
 
+// addCSRF sets valid CSRF form token and returns related cookie.
+func addCSRF(params url.Values, cfg *conf.Cfg) *http.Cookie {
+	value := strings.Repeat("a", csrfLen*2)
+	params.Set(csrfName, csrfSign(value, cfg))
+	return &http.Cookie{Name: csrfName, Value: value}
+}
+
 func TestError(t *testing.T) {
 	cfg, err := conf.New(testConfigName)
 	if err != nil {
@@ -51,34 +59,68 @@ func TestError(t *testing.T) {
 	}()
 	values := []struct {
 		Code     int
+		Lang     string
 		Expected string
 	}{
-		{http.StatusNotFound, "Page not found"},
-		{http.StatusBadRequest, "Bad createData"},
-		{http.StatusInternalServerError, "it is an error"},
-		{http.StatusMethodNotAllowed, "it is an error"},
+		{http.StatusNotFound, "", "Page not found"},
+		{http.StatusBadRequest, "en-US", "Bad request data"},
+		{http.StatusForbidden, "", "Access denied"},
+		{http.StatusInternalServerError, "", "it is an error"},
+		{http.StatusMethodNotAllowed, "", "it is an error"},
+		{http.StatusNotFound, "ru-RU,ru;q=0.9", "Страница не найдена"},
+		{http.StatusInternalServerError, "ru", "произошла ошибка"},
 	}
-	b := make([]byte, 512)
 	for i, v := range values {
 		w := httptest.NewRecorder()
-		code := Error(w, cfg, v.Code)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", v.Lang)
+		code := Error(w, r, cfg, v.Code)
 		if code != v.Code {
 			t.Errorf("failed result for case=%v code: %v", i, code)
-		} else {
-			resp := w.Result()
-			_, err = resp.Body.Read(b)
-			if err != nil {
-				t.Errorf("failed read body for case=%v", i)
-			} else {
-				strings.Contains(string(b), v.Expected)
-			}
+		} else if body := w.Body.String(); !strings.Contains(body, v.Expected) {
+			t.Errorf("failed body for case=%v: %v", i, body)
+		}
+	}
+}
+
+func TestStatic(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	values := map[string]int{
+		"/static/style.css":           http.StatusOK,
+		"/static/absent.css":          http.StatusNotFound,
+		"/static/":                    http.StatusNotFound,
+		"/static/../i18n/en.json":     http.StatusNotFound,
+		"/static/%2e%2e/i18n/ru.json": http.StatusNotFound,
+	}
+	for path, expected := range values {
+		w := httptest.NewRecorder()
+		code, err := Static(w, httptest.NewRequest("GET", path, nil), cfg)
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", path, err)
+		}
+		if code != expected {
+			t.Errorf("failed code for %v: %v", path, code)
+		}
+		if (code == http.StatusOK) && (w.Body.Len() == 0) {
+			t.Errorf("empty static file %v", path)
 		}
-		b = []byte{}
 	}
 }
 
 func TestIndex(t *testing.T) {
-	var body io.Reader
+	var (
+		body   io.Reader
+		cookie *http.Cookie
+	)
 	cfg, err := conf.New(testConfigName)
 	if err != nil {
 		t.Fatal(err)
@@ -102,7 +144,7 @@ func TestIndex(t *testing.T) {
 		{"POST", [4]string{"test", "", "1", ""}, http.StatusBadRequest, true},
 		{"POST", [4]string{"test", "10", "", ""}, http.StatusBadRequest, true},
 	}
-	b := make([]byte, 512)
+	b := make([]byte, 4096)
 	for i, v := range values {
 		w := httptest.NewRecorder()
 
@@ -111,12 +153,16 @@ func TestIndex(t *testing.T) {
 			params.Set("content", v.Params[0])
 			params.Set("ttl", v.Params[1])
 			params.Set("times", v.Params[2])
+			cookie = addCSRF(params, cfg)
 			body = strings.NewReader(params.Encode())
 		} else {
-			body = nil
+			body, cookie = nil, nil
 		}
 		r := httptest.NewRequest(v.Method, "/", body)
 		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
 
 		code, err := Index(w, r, cfg)
 		if v.Err {
@@ -155,10 +201,26 @@ func TestIndex(t *testing.T) {
 			}
 		}
 	}
+	// readings limit and default TTL of the form are the configured ones
+	cfg.Settings.Times, cfg.Settings.FormTTL = 7, 3600
+	w := httptest.NewRecorder()
+	code, err := Index(w, httptest.NewRequest("GET", "/", nil), cfg)
+	if (err != nil) || (code != http.StatusOK) {
+		t.Fatalf("failed index code=%v: %v", code, err)
+	}
+	if !strings.Contains(w.Body.String(), `name="times" min="1" max="7"`) {
+		t.Error("failed times limit")
+	}
+	if !strings.Contains(w.Body.String(), `name="ttl" list="ttl-presets" value="1h"`) {
+		t.Error("failed default ttl")
+	}
 }
 
 func TestRead(t *testing.T) {
-	var body io.Reader
+	var (
+		body   io.Reader
+		cookie *http.Cookie
+	)
 	cfg, err := conf.New(testConfigName)
 	if err != nil {
 		t.Fatal(err)
@@ -208,7 +270,7 @@ func TestRead(t *testing.T) {
 			"POST", "", http.StatusOK, false,
 		},
 	}
-	b := make([]byte, 512)
+	b := make([]byte, 4096)
 	for i, v := range values {
 		w := httptest.NewRecorder()
 
@@ -225,12 +287,22 @@ func TestRead(t *testing.T) {
 		if v.Method == "POST" {
 			params := url.Values{}
 			params.Set("password", v.Password)
+			nonce, err := db.NewNonce(cfg.CipherKey, v.Item.Key, cfg.Now(), 30)
+			if err != nil {
+				t.Errorf("failed nonce case=%v: %v", i, err)
+				continue
+			}
+			params.Set("nonce", nonce)
+			cookie = addCSRF(params, cfg)
 			body = strings.NewReader(params.Encode())
 		} else {
-			body = nil
+			body, cookie = nil, nil
 		}
 		r := httptest.NewRequest(v.Method, path, body)
 		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
 
 		code, err := Read(w, r, cfg)
 		if v.Err {
@@ -287,6 +359,194 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestReadConfirm(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Settings.SkipBots = true
+	conn := cfg.Connection()
+	item := &db.Item{Content: "Test-Item", TTL: 30, Times: 2}
+	defer func() {
+		_, err := db.Delete(item.Key, conn)
+		if err != nil {
+			t.Errorf("failed delete item: %v", err)
+		}
+		err = conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	err = item.Save(conn, cfg.CipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgNonce := regexp.MustCompile(`name="nonce" value="([0-9a-f]+)"`)
+	send := func(method, ua, nonce string) (int, string) {
+		var body io.Reader
+		params := url.Values{}
+		cookie := addCSRF(params, cfg)
+		if method == "POST" {
+			params.Set("nonce", nonce)
+			body = strings.NewReader(params.Encode())
+		}
+		r := httptest.NewRequest(method, "/"+item.Key, body)
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		r.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		code, err := Read(w, r, cfg)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return code, w.Body.String()
+	}
+	const (
+		browser = "Mozilla/5.0 (X11; Linux x86_64; rv:60.0) Gecko/20100101 Firefox/60.0"
+		bot     = "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+	)
+	// preview robots don't get a nonce and can't read content
+	code, body := send("GET", bot, "")
+	if code != http.StatusOK {
+		t.Errorf("failed bot GET code=%v", code)
+	}
+	if rgNonce.MatchString(body) {
+		t.Error("unexpected nonce for bot")
+	}
+	code, _ = send("POST", bot, "")
+	if code != http.StatusForbidden {
+		t.Errorf("failed bot POST code=%v", code)
+	}
+	// POST without nonce only shows the form again
+	code, body = send("POST", browser, "")
+	if code != http.StatusBadRequest {
+		t.Errorf("failed POST without nonce code=%v", code)
+	}
+	if strings.Contains(body, item.Content) {
+		t.Error("unexpected content without nonce")
+	}
+	for i := 0; i < 3; i++ {
+		code, body = send("GET", browser, "")
+		if code != http.StatusOK {
+			t.Errorf("failed GET code=%v", code)
+		}
+	}
+	// confirmation forms don't store nonces
+	nonces, err := redis.Strings(conn.Do("KEYS", "{"+item.Key+"}:nonce:*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nonces) != 0 {
+		t.Errorf("unexpected stored nonces: %v", nonces)
+	}
+	finds := rgNonce.FindStringSubmatch(body)
+	if len(finds) != 2 {
+		t.Fatal("nonce is not found")
+	}
+	code, body = send("POST", browser, finds[1])
+	if code != http.StatusOK {
+		t.Errorf("failed POST code=%v", code)
+	}
+	if !strings.Contains(body, item.Content) {
+		t.Error("content is not found")
+	}
+	// double submit with the same nonce
+	code, body = send("POST", browser, finds[1])
+	if code != http.StatusBadRequest {
+		t.Errorf("failed repeated POST code=%v", code)
+	}
+	if strings.Contains(body, item.Content) {
+		t.Error("unexpected content for repeated nonce")
+	}
+	ok, err := item.Exists(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("item should be available for one more reading")
+	}
+}
+
+func TestIsPreviewBot(t *testing.T) {
+	cases := []struct {
+		ua  string
+		bot bool
+	}{
+		{ua: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", bot: true},
+		{ua: "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", bot: true},
+		{ua: "Twitterbot/1.0", bot: true},
+		{ua: "Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5", bot: true},
+		{ua: "Mozilla/5.0 (X11; Linux x86_64; rv:60.0) Gecko/20100101 Firefox/60.0"},
+		{ua: "Microsoft Office/16.0 (Windows NT 10.0; Microsoft Outlook 16.0.12026; Pro)"},
+		{ua: "WhatsApp/2.23.20.0 A"},
+		{ua: "Mozilla/5.0 (Linux; Android 13) AppleWebKit/537.36 Viber/20.8.0.3"},
+		{ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148 Preview"},
+		{ua: "Mozilla/5.0 (Linux; Android 13) AppleWebKit/537.36 Chrome/118.0 Mobile Safari/537.36 Cubot"},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", c.ua)
+		if bot := isPreviewBot(r); bot != c.bot {
+			t.Errorf("failed case=%v, bot=%v", i, bot)
+		}
+	}
+}
+
+func TestReadKeyFormats(t *testing.T) {
+	cfg, err := conf.New(testConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.Connection()
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			t.Errorf("failed close connection: %v", err)
+		}
+		err = cfg.Close()
+		if err != nil {
+			t.Errorf("close error: %v", err)
+		}
+	}()
+	formats := []*db.KeyFormat{
+		{Len: 16, Encoding: db.EncodingHex},
+		{Len: 16, Encoding: db.EncodingBase62},
+		{Len: 10, Encoding: db.EncodingBase32},
+		{Len: 8, Encoding: db.EncodingWords},
+	}
+	for i, f := range formats {
+		item := &db.Item{Content: "Test-Item", TTL: 30, Times: 1, Format: f}
+		err = item.Save(conn, cfg.CipherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// case insensitive encodings accept links typed in lower case
+		links := []string{item.Key}
+		if (f.Encoding == db.EncodingBase32) || (f.Encoding == db.EncodingWords) {
+			links = append(links, strings.ToLower(item.Key), strings.ToUpper(item.Key))
+		}
+		for _, link := range links {
+			r := httptest.NewRequest("GET", "/"+link, nil)
+			w := httptest.NewRecorder()
+			code, err := Read(w, r, cfg)
+			if err != nil {
+				t.Errorf("unexpected error case=%v: %v", i, err)
+			}
+			if code != http.StatusOK {
+				t.Errorf("failed case=%v link=%v code=%v", i, link, code)
+			}
+		}
+		_, err = db.Delete(item.Key, conn)
+		if err != nil {
+			t.Errorf("failed delete item: %v", err)
+		}
+	}
+}
+
 func BenchmarkIndex(b *testing.B) {
 	cfg, err := conf.New(testConfigName)
 	if err != nil {
@@ -311,9 +571,11 @@ func BenchmarkIndex(b *testing.B) {
 		params.Set("ttl", "30")
 		params.Set("times", "1")
 		params.Set("password", "abc")
+		cookie := addCSRF(params, cfg)
 
 		r := httptest.NewRequest("POST", "/", strings.NewReader(params.Encode()))
 		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
 
 		code, err := Index(w, r, cfg)
 		if err != nil {
@@ -362,11 +624,18 @@ func BenchmarkRead(b *testing.B) {
 	}
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
+		nonce, err := db.NewNonce(cfg.CipherKey, item.Key, cfg.Now(), 30)
+		if err != nil {
+			b.Fatal(err)
+		}
 		params := url.Values{}
 		params.Set("password", password)
+		params.Set("nonce", nonce)
+		cookie := addCSRF(params, cfg)
 
 		r := httptest.NewRequest("POST", "/"+item.Key, strings.NewReader(params.Encode()))
 		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
 
 		w := httptest.NewRecorder()
 		code, err := Read(w, r, cfg)